@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/adnsv/btr/tasks"
+)
+
+// doctorProject prints the checklist produced by the project doctor, it fails
+// if any of the checks fails.
+func doctorProject(prj *tasks.Project) error {
+	checks := prj.Doctor(app_version())
+	failed := 0
+	for _, c := range checks {
+		status := "[ OK ]"
+		if !c.OK {
+			status = "[FAIL]"
+			failed++
+		}
+		fmt.Printf("%s %s\n", status, c.Message)
+	}
+	fmt.Printf("\n%d checks: %d passed, %d failed\n", len(checks), len(checks)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("doctor: %d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/adnsv/btr/tasks"
+)
+
+// formatProject rewrites the project file into the canonical layout, with
+// check it only verifies that the file is formatted.
+func formatProject(fn string, check bool) error {
+	buf, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	out, err := tasks.FormatProject(buf)
+	if err != nil {
+		return fmt.Errorf("failed to format %s: %w", fn, err)
+	}
+
+	if bytes.Equal(buf, out) {
+		fmt.Printf("%s is formatted\n", fn)
+		return nil
+	}
+	if check {
+		return fmt.Errorf("%s is not formatted, run 'btr fmt' to fix it", fn)
+	}
+
+	fmt.Printf("- writing %s ... ", fn)
+	err = os.WriteFile(fn, out, 0666)
+	if err != nil {
+		fmt.Printf("FAILED\n")
+		return err
+	}
+	fmt.Printf("SUCCEEDED\n")
+	return nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fallbackProjectVersion is written into the new project files when the
+// version of the running executable is not available (devel builds).
+const fallbackProjectVersion = "0.4.0"
+
+var presetNames = []string{"icon-font", "resources", "app-icon"}
+
+// scaffoldInfo contains the values that are substituted into the templates.
+type scaffoldInfo struct {
+	Version      string
+	FontSource   string
+	FontName     string
+	IconSource   string
+	ResourceName string
+	ResSource    string
+}
+
+// initProject writes a new project file, target is either a directory or a
+// path to the project file (defaults to build-tasks.yaml in CWD).
+func initProject(target string, preset string, force bool) error {
+	if preset != "" && !slices.Contains(presetNames, preset) {
+		return fmt.Errorf("unsupported preset '%s', must be one of: %s",
+			preset, strings.Join(presetNames, ", "))
+	}
+
+	fn := target
+	if fn == "" {
+		fn = "build-tasks.yaml"
+	} else if stat, err := os.Stat(fn); err == nil && stat.IsDir() {
+		fn = filepath.Join(fn, "build-tasks.yaml")
+	}
+	fn, err := filepath.Abs(fn)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(fn); err == nil && !force {
+		return fmt.Errorf("file %s already exists, use --force to overwrite it", fn)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	info := &scaffoldInfo{
+		Version:      fallbackProjectVersion,
+		FontSource:   "./icons/*.svg",
+		FontName:     "app-font",
+		IconSource:   "./app-icon/*.png",
+		ResourceName: "resources",
+		ResSource:    "./resources/**/*.*",
+	}
+	if v := pinnedVersion(); v != "" {
+		info.Version = v
+	}
+
+	svgDir, pngDir, resDir := detectSourceDirs(filepath.Dir(fn))
+	if svgDir != "" {
+		info.FontSource = "./" + svgDir + "/*.svg"
+		info.FontName = filepath.Base(svgDir)
+	}
+	if pngDir != "" {
+		info.IconSource = "./" + pngDir + "/*.png"
+	}
+	if resDir != "" {
+		info.ResSource = "./" + resDir + "/**/*.*"
+		info.ResourceName = filepath.Base(resDir)
+	}
+
+	presets := []string{}
+	if preset != "" {
+		presets = append(presets, preset)
+	} else {
+		if svgDir != "" {
+			presets = append(presets, "icon-font")
+		}
+		if pngDir != "" {
+			presets = append(presets, "app-icon")
+		}
+		if resDir != "" || len(presets) == 0 {
+			presets = append(presets, "resources")
+		}
+	}
+
+	buf := bytes.Buffer{}
+	err = scaffoldTemplates.ExecuteTemplate(&buf, "head", info)
+	if err != nil {
+		return err
+	}
+	for _, p := range presets {
+		err = scaffoldTemplates.ExecuteTemplate(&buf, p, info)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("- writing %s ... ", fn)
+	err = os.WriteFile(fn, buf.Bytes(), 0666)
+	if err != nil {
+		fmt.Printf("FAILED\n")
+		return err
+	}
+	fmt.Printf("SUCCEEDED\n")
+	fmt.Printf("presets: %s\n", strings.Join(presets, ", "))
+	return nil
+}
+
+// detectSourceDirs looks for the subdirectories that contain the most SVG
+// and PNG files, and for a directory with resource files. The returned paths
+// are relative to the base dir and use forward slashes.
+func detectSourceDirs(base string) (svgDir, pngDir, resDir string) {
+	svgCounts := map[string]int{}
+	pngCounts := map[string]int{}
+	filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			name := d.Name()
+			if rel != "." && (strings.HasPrefix(name, ".") || name == "node_modules" ||
+				name == "build" || strings.Count(rel, "/") >= 3) {
+				return filepath.SkipDir
+			}
+			if rel != "." && resDir == "" && (name == "resources" || name == "res" || name == "assets") {
+				resDir = rel
+			}
+			return nil
+		}
+		dir := filepath.ToSlash(filepath.Dir(rel))
+		if dir == "." {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(rel)) {
+		case ".svg":
+			svgCounts[dir]++
+		case ".png":
+			pngCounts[dir]++
+		}
+		return nil
+	})
+	return mostFiles(svgCounts), mostFiles(pngCounts), resDir
+}
+
+func mostFiles(counts map[string]int) string {
+	dirs := make([]string, 0, len(counts))
+	for d := range counts {
+		dirs = append(dirs, d)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if counts[dirs[i]] != counts[dirs[j]] {
+			return counts[dirs[i]] > counts[dirs[j]]
+		}
+		return dirs[i] < dirs[j]
+	})
+	if len(dirs) == 0 {
+		return ""
+	}
+	return dirs[0]
+}
+
+// yamlScalar renders s as a yaml scalar, quoted when the detected paths and
+// names contain characters that are special in yaml.
+func yamlScalar(s string) (string, error) {
+	n := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+	if strings.ContainsAny(s, "\r\n") {
+		n.Style = yaml.DoubleQuotedStyle
+	}
+	buf, err := yaml.Marshal(n)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(buf), "\n"), nil
+}
+
+var scaffoldTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"yaml": yamlScalar,
+}).Parse(`
+{{- define "head" -}}
+# btr project file, see https://github.com/adnsv/btr for details
+
+# minimal version of btr required to run these tasks
+version: {{yaml .Version}}
+
+# user-defined variables, use them in the tasks with the ${var-name} syntax
+vars:
+  "cpp-head": |
+    // DO NOT EDIT: Generated file
+    // clang-format off
+
+  "hpp-head": |
+    #pragma once
+
+    // DO NOT EDIT: Generated file
+    // clang-format off
+
+# the tasks are executed in the order of appearance
+tasks:
+  - name: Create directory for temporary files
+    type: dir
+    var: tmp-dir
+{{end}}
+
+{{- define "icon-font" }}
+  # icon-font: compose SVG icons into a font and embed it as a C++ resource
+
+  - name: Make SVG font
+    type: svgfont
+    source: {{yaml .FontSource}}
+    target: {{yaml (print "${tmp-dir}/" .FontName ".svg")}}
+    first-codepoint: U+F000
+
+  - name: Convert SVG font to TTF
+    type: ttf # requires svg2ttf: npm install -g svg2ttf
+    source: {{yaml (print "${tmp-dir}/" .FontName ".svg")}}
+    target: {{yaml (print "${tmp-dir}/" .FontName ".ttf")}}
+
+  - name: Make C++ header for font glyphs
+    type: glyph-names
+    source: {{yaml (print "${tmp-dir}/" .FontName ".svg")}}
+    target:
+      file: {{yaml (print "./" .FontName "-glyphs.hpp")}}
+      entry: "char const* ${ident-cpp}\t= \"${utf8-escaped-cpp}\";\t// ${unicode} ${name}"
+      content: |
+        ${hpp-head}
+
+        // codepoint range: U+${codepoint-min} - U+${codepoint-max}
+
+        namespace icon {
+
+        ${entries}
+
+        } // namespace icon
+
+  - name: Generate C++ binary resource for TTF font
+    type: binpack
+    source: {{yaml (print "${tmp-dir}/" .FontName ".ttf")}}
+    target:
+      - file: {{yaml (print "./" .FontName "-resource.hpp")}}
+        entry: extern const std::array<unsigned char, ${byte-count}> ${ident-cpp};
+        content: |
+          ${hpp-head}
+          #include <array>
+
+          namespace resource {
+
+          ${entries}
+
+          } // namespace resource
+
+      - file: {{yaml (print "./" .FontName "-resource.cpp")}}
+        entry: |
+          const std::array<unsigned char, ${byte-count}> ${ident-cpp} = {
+          ${byte-content}
+          };
+        content: |
+          ${cpp-head}
+          #include "{{.FontName}}-resource.hpp"
+
+          namespace resource {
+
+          ${entries}
+
+          } // namespace resource
+{{end}}
+
+{{- define "resources" }}
+  # resources: embed binary files as C++ arrays
+
+  - name: Generate C++ binary resources
+    type: binpack
+    source: {{yaml .ResSource}}
+    target:
+      - file: {{yaml (print "./" .ResourceName ".hpp")}}
+        entry: extern const std::array<unsigned char, ${byte-count}> ${ident-cpp};
+        content: |
+          ${hpp-head}
+          #include <array>
+
+          namespace resource {
+
+          ${entries}
+
+          } // namespace resource
+
+      - file: {{yaml (print "./" .ResourceName ".cpp")}}
+        entry: |
+          const std::array<unsigned char, ${byte-count}> ${ident-cpp} = {
+          ${byte-content}
+          };
+        content: |
+          ${cpp-head}
+          #include "{{.ResourceName}}.hpp"
+
+          namespace resource {
+
+          ${entries}
+
+          } // namespace resource
+{{end}}
+
+{{- define "app-icon" }}
+  # app-icon: multi-resolution application icons from a set of PNG files
+
+  - name: Codegen embeddable application icon resource
+    type: embed-icon
+    source: {{yaml .IconSource}}
+    target: ./app-icon.embed.cpp
+
+  - name: Prepare WIN32 icon resource
+    type: win32-icon
+    source: {{yaml .IconSource}}
+    target: ./app-icon.win32.ico
+{{end}}
+`))
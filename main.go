@@ -6,6 +6,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/adnsv/btr/tasks"
 )
@@ -13,22 +18,104 @@ import (
 func printHelp(w io.Writer) {
 	fmt.Fprint(w, `btr - a build-task-runner utility (https://github.com/adnsv/btr)
 
-usage: btr [options] <filename>
+usage: btr [command] [options] <filename>
 
 <filename>      A yaml file that describes what needs to be done
                 (defaults to build-tasks.yaml in CWD).
 
+commands:
+    run         Execute the tasks (default).
+    clean       Remove the files and directories produced by previous runs.
+    init        Write a new project file with commented example tasks.
+    migrate     Upgrade a project file to the current format, legacy json
+                files are converted to yaml.
+    fmt         Rewrite a project file into the canonical layout.
+    doctor      Check that the project can run in this environment: the
+                external tools, the target directories, the source files,
+                and the variables.
+
+workspaces:
+    btr [run|clean] -r <root>
+                Discover the project files in the root directory and its
+                subdirectories and process all of them.
+    btr [run|clean] <workspace.yaml>
+                Process the projects listed in the workspace file (also
+                picked up from a directory without a build-tasks.yaml file).
+
 options:
     --version   Display application version and exit.
-	--verbose   Provide detailed information when running tasks.
+    --verbose   Provide detailed information when running tasks.
+    --dry-run   Only report what would be changed (clean and migrate
+                commands).
+    --out-dir <dir>
+                Base directory for the generated files, overrides the
+                output-dir field of the project file.
+    --lock-timeout <duration>
+                How long to wait for other btr processes working with the
+                same output directory, e.g. 30s or 10m (default: 5m).
+    --preset <name>
+                Project template for the init command: icon-font, resources,
+                or app-icon (default: detected from the existing files).
+    --force     Allow the init and migrate commands to overwrite an existing
+                file.
+    --check     Do not rewrite the file, fail if it is not formatted (fmt
+                command).
+    -r, --recursive
+                Run in workspace mode, discovering the project files.
+    -j, --jobs <count>
+                Maximum number of workspace projects processed concurrently
+                (default: number of CPUs).
+    --profile   Print the time spent in each task and its phases (read,
+                decode, encode, exec, write) along with the amounts of data
+                read and written.
+    --trace <file>
+                Write the task timings to a file in the Chrome trace event
+                format (chrome://tracing, https://ui.perfetto.dev).
 `)
 }
 
+// optionValue extracts the value of the option at os.Args[*i] that is
+// specified either as '--name value' or as '--name=value'.
+func optionValue(name string, i *int) (string, bool) {
+	a := os.Args[*i]
+	if a == name {
+		if *i+1 >= len(os.Args) {
+			log.Fatalf("%s: missing value", name)
+		}
+		*i++
+		return os.Args[*i], true
+	} else if strings.HasPrefix(a, name+"=") {
+		return strings.TrimPrefix(a, name+"="), true
+	}
+	return "", false
+}
+
+// optionValueAny is optionValue that accepts several names of the option.
+func optionValueAny(names []string, i *int) (string, bool) {
+	for _, name := range names {
+		if v, ok := optionValue(name, i); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
 func main() {
 	verbose := false
+	dry_run := false
+	out_dir := ""
+	lock_timeout := tasks.DefaultLockTimeout
+	preset := ""
+	force := false
+	check := false
+	recursive := false
+	jobs := runtime.NumCPU()
+	profile := false
+	trace_fn := ""
 	args := []string{}
 
-	for _, a := range os.Args[1:] {
+	for i := 1; i < len(os.Args); i++ {
+		a := os.Args[i]
 		if a == "" {
 			continue
 		} else if a[0] == '-' {
@@ -39,6 +126,34 @@ func main() {
 				printHelp(os.Stdout)
 			} else if a == "-v" || a == "--verbose" {
 				verbose = true
+			} else if a == "--dry-run" {
+				dry_run = true
+			} else if a == "--force" {
+				force = true
+			} else if a == "--check" {
+				check = true
+			} else if a == "-r" || a == "--recursive" {
+				recursive = true
+			} else if a == "--profile" {
+				profile = true
+			} else if v, ok := optionValue("--out-dir", &i); ok {
+				out_dir = v
+			} else if v, ok := optionValue("--lock-timeout", &i); ok {
+				d, err := time.ParseDuration(v)
+				if err != nil {
+					log.Fatalf("--lock-timeout: %s", err)
+				}
+				lock_timeout = d
+			} else if v, ok := optionValue("--trace", &i); ok {
+				trace_fn = v
+			} else if v, ok := optionValue("--preset", &i); ok {
+				preset = v
+			} else if v, ok := optionValueAny([]string{"-j", "--jobs"}, &i); ok {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 {
+					log.Fatalf("--jobs: must be a positive integer")
+				}
+				jobs = n
 			} else {
 				fmt.Printf("warning: unsupported arg %s\n", a)
 			}
@@ -47,16 +162,60 @@ func main() {
 		}
 	}
 
+	command := "run"
+	if len(args) > 0 && (args[0] == "run" || args[0] == "clean" || args[0] == "init" ||
+		args[0] == "migrate" || args[0] == "fmt" || args[0] == "doctor") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	if command == "init" {
+		if len(args) > 1 {
+			log.Fatal("invalid command line syntax: more than one argument provided")
+		}
+		target := ""
+		if len(args) == 1 {
+			target = args[0]
+		}
+		err := initProject(target, preset, force)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	proj_dir := ""
 	proj_fn := ""
 	var err error
+	if len(args) > 1 {
+		log.Fatal("invalid command line syntax: more than one argument provided")
+	}
+
+	if trace_fn != "" && (recursive || command != "run") {
+		log.Fatal("--trace: only supported when running a single project")
+	}
+
+	if recursive {
+		root := "."
+		if len(args) == 1 {
+			root = args[0]
+		}
+		ws, err := tasks.DiscoverWorkspace(root)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = runWorkspace(ws, command, jobs, verbose, dry_run, out_dir, lock_timeout, profile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if len(args) == 0 {
 		proj_dir, err = os.Getwd()
 		if err != nil {
 			log.Fatal(err)
 		}
-	} else if len(args) > 1 {
-		log.Fatal("invalid command line syntax: more than one argument provided")
 	} else {
 		stat, err := os.Stat(args[0])
 		if err == nil && stat.IsDir() {
@@ -69,7 +228,17 @@ func main() {
 		proj_fn = filepath.Join(proj_dir, "build-tasks.yaml")
 		if _, err := os.Stat(proj_fn); os.IsNotExist(err) {
 			proj_fn = filepath.Join(proj_dir, "build-tasks.yml")
-			if _, err = os.Stat(proj_fn); os.IsNotExist(err) {
+			if _, err = os.Stat(proj_fn); os.IsNotExist(err) && command == "migrate" {
+				proj_fn = filepath.Join(proj_dir, "build-tasks.json")
+				_, err = os.Stat(proj_fn)
+			}
+			for _, n := range tasks.WorkspaceFileNames {
+				if os.IsNotExist(err) && (command == "run" || command == "clean") {
+					proj_fn = filepath.Join(proj_dir, n)
+					_, err = os.Stat(proj_fn)
+				}
+			}
+			if os.IsNotExist(err) {
 				log.Fatal("failed to load task descriptions\n" +
 					"specify the path to the btr project file (e.g., build-tasks.yml)" +
 					"or run btr from a directory that contains that file.")
@@ -81,6 +250,34 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	if slices.Contains(tasks.WorkspaceFileNames, filepath.Base(proj_fn)) {
+		ws, err := tasks.LoadWorkspace(proj_fn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = runWorkspace(ws, command, jobs, verbose, dry_run, out_dir, lock_timeout, profile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if command == "migrate" {
+		err = migrateProject(proj_fn, dry_run, force)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if command == "fmt" {
+		err = formatProject(proj_fn, check)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if verbose {
 		fmt.Printf("opening task descriptions from: %s\n", proj_fn)
 	}
@@ -90,19 +287,84 @@ func main() {
 		log.Fatal(err)
 	}
 
+	prj.Verbose = verbose
+
+	if out_dir != "" {
+		out_dir, err = filepath.Abs(out_dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = prj.SetOutDir(out_dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if verbose {
+		fmt.Printf("output directory: %s\n", prj.OutDir)
+	}
+
+	if command == "doctor" {
+		err = doctorProject(prj)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	unlock, err := prj.Lock(lock_timeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer unlock()
+
+	if command == "clean" {
+		err = prj.Clean(dry_run)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if verbose {
 		fmt.Printf("loaded tasks: %d\n", len(prj.Tasks))
 		fmt.Printf("running loaded tasks\n")
 	}
-	prj.Verbose = verbose
 	err = prj.ValidateVersion(app_version())
 	if err != nil {
 		log.Fatal(err)
 	}
+	if profile || trace_fn != "" {
+		prj.Profile = tasks.NewProfile()
+	}
 	err = prj.Run()
+	if profile {
+		fmt.Print("\nprofile:\n")
+		prj.Profile.WriteReport(os.Stdout)
+	}
+	if trace_fn != "" {
+		if e := writeTrace(prj.Profile, trace_fn); e != nil && err == nil {
+			err = e
+		}
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	fmt.Print("\nmission accomplished\n")
 }
+
+// writeTrace saves the profile in the Chrome trace event format.
+func writeTrace(p *tasks.Profile, fn string) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return fmt.Errorf("--trace: %w", err)
+	}
+	err = p.WriteTrace(f)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return fmt.Errorf("--trace: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adnsv/btr/tasks"
+	"github.com/blang/semver/v4"
+)
+
+// pinnedVersion returns the version of the running executable in the form
+// that is written into the project files, or an empty string for devel
+// builds.
+func pinnedVersion() string {
+	v, err := semver.ParseTolerant(app_version())
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// migrateProject upgrades the project file, legacy json files are converted
+// into yaml files written next to them.
+func migrateProject(fn string, dryRun bool, force bool) error {
+	buf, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	version := pinnedVersion()
+	if version == "" {
+		fmt.Printf("WARNING: keeping the version field: running devel build\n")
+	}
+	out, changes, err := tasks.MigrateProject(buf, version)
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", fn, err)
+	}
+
+	dst := fn
+	if strings.ToLower(filepath.Ext(fn)) == ".json" {
+		dst = tasks.ReplaceExtension(fn, ".yaml")
+		if _, err := os.Stat(dst); err == nil && !force {
+			return fmt.Errorf("file %s already exists, use --force to overwrite it", dst)
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if len(changes) == 0 && dst == fn {
+		fmt.Printf("%s is up to date\n", fn)
+		return nil
+	}
+	for _, c := range changes {
+		fmt.Printf("- %s\n", c)
+	}
+	if dryRun {
+		return nil
+	}
+
+	fmt.Printf("- writing %s ... ", dst)
+	err = os.WriteFile(dst, out, 0666)
+	if err != nil {
+		fmt.Printf("FAILED\n")
+		return err
+	}
+	fmt.Printf("SUCCEEDED\n")
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adnsv/btr/tasks"
+)
+
+// runWorkspace executes the run or clean command for all the projects of the
+// workspace and prints the combined summary. With out_dir specified, each
+// project gets its own subdirectory within it. With profile, the timings of
+// each project are printed after its tasks.
+func runWorkspace(ws *tasks.Workspace, command string, jobs int, verbose bool,
+	dry_run bool, out_dir string, lock_timeout time.Duration, profile bool) error {
+
+	if command != "run" && command != "clean" {
+		return fmt.Errorf("the %s command does not support workspaces", command)
+	}
+	if out_dir != "" {
+		var err error
+		ws.OutDir, err = filepath.Abs(out_dir)
+		if err != nil {
+			return err
+		}
+	}
+	if verbose {
+		fmt.Printf("workspace: %s\n", ws.Root)
+		fmt.Printf("projects: %d\n", len(ws.Projects))
+	}
+
+	results := ws.Run(jobs, os.Stdout, func(prj *tasks.Project) error {
+		prj.Verbose = verbose
+		unlock, err := prj.Lock(lock_timeout)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if command == "clean" {
+			return prj.Clean(dry_run)
+		}
+		err = prj.ValidateVersion(app_version())
+		if err != nil {
+			return err
+		}
+		if profile {
+			prj.Profile = tasks.NewProfile()
+			defer func() {
+				prj.Printf("profile:\n")
+				prj.Profile.WriteReport(prj.Log)
+			}()
+		}
+		return prj.Run()
+	})
+
+	width := 0
+	for _, r := range results {
+		width = max(width, len(r.Project.Name))
+	}
+	succeeded, failed, skipped := 0, 0, 0
+	fmt.Printf("\nworkspace summary:\n")
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			skipped++
+			fmt.Printf("  SKIPPED  %-*s  %s\n", width, r.Project.Name, r.Err)
+		case r.Err != nil:
+			failed++
+			fmt.Printf("  FAILED   %-*s  %6s  %s\n", width, r.Project.Name, formatDuration(r.Duration), r.Err)
+		default:
+			succeeded++
+			s := fmt.Sprintf("  OK       %-*s  %6s", width, r.Project.Name, formatDuration(r.Duration))
+			if command == "run" {
+				s += fmt.Sprintf("  outputs: %d", r.Outputs)
+			}
+			fmt.Println(s)
+		}
+	}
+	fmt.Printf("%d projects: %d succeeded, %d failed, %d skipped\n",
+		len(results), succeeded, failed, skipped)
+
+	if failed > 0 || skipped > 0 {
+		return fmt.Errorf("workspace: %d of %d projects did not succeed", failed+skipped, len(results))
+	}
+	if command == "run" {
+		fmt.Print("\nmission accomplished\n")
+	}
+	return nil
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
@@ -0,0 +1,511 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/bmatcuk/doublestar/v4"
+	"golang.org/x/exp/maps"
+)
+
+// DoctorCheck is an item of the checklist produced by Doctor.
+type DoctorCheck struct {
+	OK      bool
+	Message string
+}
+
+// templateVars lists the variables that the tasks define while expanding
+// their templates, per task type.
+var templateVars = map[string][]string{
+	"binpack":     {"byte-count", "byte-content", "filename", "ident-cpp", "entries"},
+	"concat":      {"filename", "index"},
+	"copy":        {"name", "stem", "ext"},
+	"glyph-names": {"name", "ident-cpp", "unicode", "unicode-hex", "utf8", "utf8-escaped-cpp", "codepoint-min", "codepoint-max", "entries"},
+}
+
+// toolVersionArgs lists the external tools the doctor reports the versions of.
+var toolVersionArgs = map[string][]string{
+	"svg2ttf": {"--version"},
+	"node":    {"--version"},
+	"git":     {"--version"},
+}
+
+// toolAdvice suggests how to install the missing tools.
+var toolAdvice = map[string]string{
+	"svg2ttf": "install it with: npm install -g svg2ttf",
+	"node":    "install node.js from https://nodejs.org",
+	"git":     "install git from https://git-scm.com",
+}
+
+type doctor struct {
+	prj      *Project
+	checks   []*DoctorCheck
+	tools    map[string][]string // tool -> labels of the tasks that need it
+	targets  map[string]string   // planned target path -> label of the task
+	dirs     map[string]string   // planned directory -> label of the task
+	ids      map[string]bool     // ids of the tasks that export variables
+	writable map[string]bool     // checked directories
+}
+
+func (d *doctor) check(ok bool, format string, args ...any) {
+	d.checks = append(d.checks, &DoctorCheck{OK: ok, Message: fmt.Sprintf(format, args...)})
+}
+
+// Doctor verifies that the project can run in the current environment without
+// running it: the version of btr, the external tools the tasks need, the
+// write permissions in the target directories, the source files, and the
+// variables referred to within the tasks.
+func (prj *Project) Doctor(appver string) []*DoctorCheck {
+	d := &doctor{
+		prj:      prj,
+		tools:    map[string][]string{},
+		targets:  map[string]string{},
+		dirs:     map[string]string{},
+		ids:      map[string]bool{},
+		writable: map[string]bool{},
+	}
+
+	d.checkVersion(appver)
+	d.checkWritable(prj.OutDir, "output directory")
+
+	// the variables defined by the tasks are simulated in a copy
+	global_vars := prj.Vars
+	prj.Vars = maps.Clone(global_vars)
+	defer func() { prj.Vars = global_vars }()
+
+	for i, t := range prj.Tasks {
+		label := fmt.Sprintf("task %d", i+1)
+		if t.Name != "" {
+			label = fmt.Sprintf("%s '%s'", label, t.Name)
+		}
+		d.visit(t, label)
+	}
+
+	d.checkTools()
+	return d.checks
+}
+
+func errorOr(err error, s string) string {
+	if err != nil {
+		return err.Error()
+	}
+	return s
+}
+
+func (d *doctor) checkVersion(appver string) {
+	prj := d.prj
+	if prj.Version == "" {
+		d.check(false, "version: missing in the project file")
+		return
+	}
+	constraint, err := ParseVersionConstraint(prj.Version)
+	if err != nil {
+		d.check(false, "version: invalid constraint '%s'", prj.Version)
+		return
+	}
+	v, err := semver.ParseTolerant(appver)
+	if err != nil {
+		d.check(true, "btr version: %s (development build, version check skipped)", appver)
+		return
+	}
+	prj.appVersion = &v
+	d.check(constraint.Check(v), "btr version: %s, the project requires %s", v, constraint)
+}
+
+// visit collects the requirements of the task and its hooks in the order
+// they are executed.
+func (d *doctor) visit(t *Task, label string) {
+	prj := d.prj
+	if t.Enabled != nil && !*t.Enabled {
+		return
+	}
+
+	outer := prj.Vars
+	if len(t.Vars) > 0 {
+		scoped := maps.Clone(outer)
+		for k, v := range t.Vars {
+			scoped[k] = v
+		}
+		prj.Vars = scoped
+	}
+	defer func() {
+		if len(t.Vars) > 0 {
+			for k, v := range prj.Vars {
+				if _, isLocal := t.Vars[k]; !isLocal {
+					outer[k] = v
+				}
+			}
+			prj.Vars = outer
+		}
+	}()
+
+	for i, h := range t.Before {
+		d.visit(h, fmt.Sprintf("%s, before[%d]", label, i))
+	}
+
+	d.checkVars(t, label)
+
+	_, builtin := taskTypeFieldOrder[t.Type]
+	switch {
+	case t.Type == "":
+	case t.Type == "ttf":
+		d.need("svg2ttf", label)
+		d.need("node", label)
+	case t.Type == "exec":
+		d.visitExec(t, label)
+	case !builtin:
+		fn, err := prj.findPlugin(t.Type)
+		if err == nil && fn == "" {
+			err = fmt.Errorf("neither declared in the plugins section nor found in PATH as %s%s", PluginPrefix, t.Type)
+		}
+		d.check(err == nil, "%s: plugin for type '%s': %s", label, t.Type, errorOr(err, fn))
+	}
+	if t.Type == "build-info" && t.Fields["git"] != false {
+		d.need("git", label)
+	}
+
+	d.checkSources(t, label)
+	d.planTargets(t, label)
+
+	if t.ID != "" {
+		d.ids[t.ID] = true
+	}
+	for i, h := range t.After {
+		d.visit(h, fmt.Sprintf("%s, after[%d]", label, i))
+	}
+}
+
+func (d *doctor) need(tool string, label string) {
+	d.tools[tool] = append(d.tools[tool], label)
+}
+
+// needCommand records a program, the paths with slashes are relative to the
+// project directory.
+func (d *doctor) needCommand(name string, label string) {
+	if strings.ContainsAny(name, `/\`) {
+		if fn, err := d.prj.AbsPath(name); err == nil {
+			name = filepath.FromSlash(fn)
+		}
+	}
+	d.need(name, label)
+}
+
+func (d *doctor) visitExec(t *Task, label string) {
+	if t.Fields["shell"] == true {
+		if filepath.Separator == '\\' {
+			d.need("cmd", label)
+		} else {
+			d.need("sh", label)
+		}
+	} else if s, ok := t.Fields["command"].(string); ok {
+		if words, err := splitArgs(s); err == nil {
+			if name, err := ExpandVariables(words[0], d.prj.Vars); err == nil {
+				d.needCommand(name, label)
+			}
+		}
+	} else if items, ok := t.Fields["command"].([]any); ok && len(items) > 0 {
+		if name, err := getArg(d.prj, items[0]); err == nil {
+			d.needCommand(name, label)
+		}
+	}
+	if s, ok := t.Fields["capture"].(string); ok {
+		d.prj.Vars[s] = ""
+	}
+}
+
+func (d *doctor) checkTools() {
+	names := maps.Keys(d.tools)
+	sort.Strings(names)
+	for _, name := range names {
+		users := strings.Join(d.tools[name], ", ")
+		path, err := exec.LookPath(name)
+		if err != nil {
+			advice := ""
+			if s := toolAdvice[name]; s != "" {
+				advice = ", " + s
+			}
+			d.check(false, "%s: not found (required by %s)%s", name, users, advice)
+			continue
+		}
+		info := path
+		if args, ok := toolVersionArgs[name]; ok {
+			out, err := exec.Command(path, args...).CombinedOutput()
+			if err != nil {
+				d.check(false, "%s: failed to run '%s %s': %s", name, name, strings.Join(args, " "), err)
+				continue
+			}
+			first, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+			info = fmt.Sprintf("%s (%s)", first, path)
+		}
+		d.check(true, "%s: %s", name, info)
+	}
+}
+
+// checkVars verifies that all the variables referred to within the task can
+// be resolved at the time the task runs.
+func (d *doctor) checkVars(t *Task, label string) {
+	local := map[string]bool{}
+	for _, name := range templateVars[t.Type] {
+		local[name] = true
+	}
+	if t.Type == "replace" {
+		for _, name := range replaceGroupNames(t.Fields["rules"]) {
+			local[name] = true
+		}
+	}
+	refs := map[string]bool{}
+	if _, builtin := taskTypeFieldOrder[t.Type]; builtin || t.Type == "" {
+		varRefs(refs, t.Fields)
+	} else {
+		varRefs(refs, stripPluginEscapes(t.Fields))
+	}
+	for _, v := range t.Vars {
+		varRefs(refs, v)
+	}
+	names := maps.Keys(refs)
+	sort.Strings(names)
+	uses_git := false
+	for _, name := range names {
+		if _, ok := d.prj.Vars[name]; ok || local[name] {
+			continue
+		} else if IsGitVar(name) {
+			uses_git = true
+			continue
+		}
+		if id, _, ok := strings.Cut(name, "."); ok && d.ids[id] {
+			continue
+		}
+		d.check(false, "%s: unresolved variable ${%s}", label, name)
+	}
+	if uses_git {
+		d.need("git", label)
+	}
+
+	// the variables defined by the task, for the following tasks
+	switch t.Type {
+	case "dir":
+		name, _ := t.Fields["var"].(string)
+		if name == "" {
+			break
+		}
+		path := filepath.ToSlash(d.prj.TempDir())
+		if s, ok := t.Fields["path"].(string); ok && s != "" {
+			if p, err := d.prj.AbsTargetPath(s); err == nil {
+				path = p
+			}
+		}
+		d.prj.Vars[name] = path
+	case "load-vars":
+		src := &VarsSource{}
+		src.File, _ = t.Fields["source"].(string)
+		src.Format, _ = t.Fields["format"].(string)
+		src.Prefix, _ = t.Fields["prefix"].(string)
+		n, err := d.prj.LoadVars(src)
+		d.check(err == nil, "%s: %s", label, errorOr(err, fmt.Sprintf("%d variables loaded", n)))
+	}
+}
+
+// varRefs collects the names of the variables referred to within v (a string,
+// or nested maps and arrays of strings).
+func varRefs(refs map[string]bool, v any) {
+	switch v := v.(type) {
+	case string:
+		for _, m := range dollar_curly_re.FindAllStringSubmatch(v, -1) {
+			refs[m[1]] = true
+		}
+	case []any:
+		for _, item := range v {
+			varRefs(refs, item)
+		}
+	case map[string]any:
+		for _, item := range v {
+			varRefs(refs, item)
+		}
+	}
+}
+
+// checkSources reports the source patterns that match no files, unless the
+// files are produced by the preceding tasks.
+func (d *doctor) checkSources(t *Task, label string) {
+	prj := d.prj
+	fields := map[string]any{}
+	switch t.Type {
+	case "exec":
+		fields["inputs"] = t.Fields["inputs"]
+	case "dir", "file", "build-info", "":
+	default:
+		fields["source"] = t.Fields["source"]
+	}
+	for k, v := range fields {
+		if v == nil {
+			continue
+		}
+		patterns, err := prj.GetStrings(v)
+		if err != nil {
+			continue
+		}
+		for _, p := range patterns {
+			if p == "" || p[0] == '!' {
+				continue
+			}
+			fns, err := prj.AbsExistingPaths([]string{p})
+			if err != nil {
+				// unresolved variables are reported separately
+				continue
+			}
+			if len(fns) > 0 {
+				d.check(true, "%s: %s '%s': %s", label, k, p, countOf(len(fns), "file"))
+				continue
+			}
+			if by := d.producedBy(p); by != "" {
+				d.check(true, "%s: %s '%s': produced by %s", label, k, p, by)
+				continue
+			}
+			d.check(false, "%s: %s '%s': no files found", label, k, p)
+		}
+	}
+}
+
+// producedBy returns the label of the preceding task that produces a file
+// matching the source pattern, or a directory the pattern may refer to.
+func (d *doctor) producedBy(pattern string) string {
+	fn, err := d.prj.AbsPath(pattern)
+	if err != nil {
+		return ""
+	}
+	targets := maps.Keys(d.targets)
+	sort.Strings(targets)
+	for _, target := range targets {
+		if ok, _ := doublestar.Match(fn, target); ok {
+			return d.targets[target]
+		}
+	}
+	// the content of the directories is not known in advance, so any pattern
+	// that may reach into them counts
+	dirs := maps.Keys(d.dirs)
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if patternReaches(fn, dir) {
+			return d.dirs[dir]
+		}
+	}
+	return ""
+}
+
+// patternReaches reports whether the pattern may match the paths within dir.
+func patternReaches(pattern, dir string) bool {
+	segs := strings.Split(pattern, "/")
+	dir_segs := strings.Split(dir, "/")
+	if len(segs) <= len(dir_segs) {
+		return false
+	}
+	for i, s := range dir_segs {
+		if segs[i] == "**" {
+			return true
+		}
+		if ok, _ := doublestar.Match(segs[i], s); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// planTargets records the files and directories the task produces and checks
+// that they can be written.
+func (d *doctor) planTargets(t *Task, label string) {
+	prj := d.prj
+	add := func(s string) {
+		fn, err := prj.AbsTargetPath(s)
+		if err != nil {
+			return
+		}
+		d.targets[fn] = label
+		d.checkWritable(filepath.Dir(fn), label)
+	}
+	switch t.Type {
+	case "dir", "copy":
+		path := filepath.ToSlash(prj.TempDir())
+		k := "path"
+		if t.Type == "copy" {
+			k = "target"
+		}
+		if s, ok := t.Fields[k].(string); ok && s != "" {
+			if p, err := prj.AbsTargetPath(s); err == nil {
+				path = p
+			}
+		}
+		d.dirs[path] = label
+		d.checkWritable(path, label)
+		return
+	}
+	for _, k := range []string{"target", "hpp-target", "cpp-target", "html-preview", "outputs"} {
+		switch v := t.Fields[k].(type) {
+		case string:
+			add(v)
+		case map[string]any:
+			if s, ok := v["file"].(string); ok {
+				add(s)
+			}
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					add(s)
+				} else if m, ok := item.(map[string]any); ok {
+					if s, ok := m["file"].(string); ok {
+						add(s)
+					}
+				}
+			}
+		}
+	}
+}
+
+// checkWritable verifies that a file can be created within dir or, if it
+// does not exist yet, within its closest existing parent.
+func (d *doctor) checkWritable(dir string, label string) {
+	if _, ok := d.prj.fsys().(OSFS); !ok {
+		return
+	}
+	existing := filepath.FromSlash(dir)
+	for {
+		stat, err := os.Stat(existing)
+		if err == nil && stat.IsDir() {
+			break
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	key := filepath.ToSlash(existing)
+	if d.writable[key] {
+		return
+	}
+	d.writable[key] = true
+
+	f, err := os.CreateTemp(existing, ".btr-doctor-*")
+	if err == nil {
+		f.Close()
+		os.Remove(f.Name())
+		d.check(true, "%s: %s is writable", label, key)
+	} else {
+		d.check(false, "%s: %s is not writable: %s", label, key, err)
+	}
+}
+
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package tasks
+
+import "os/exec"
+
+// process groups are not available on this platform, only the command itself
+// is killed on timeout
+
+func killProcessGroup(cmd *exec.Cmd) {}
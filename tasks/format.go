@@ -0,0 +1,135 @@
+package tasks
+
+import (
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// projectFieldOrder is the canonical order of the top-level project fields.
+var projectFieldOrder = []string{"version", "output-dir", "plugins", "vars-from", "vars", "tasks"}
+
+// taskFieldOrder is the canonical order of the fields common to all tasks.
+var taskFieldOrder = []string{"name", "type", "id", "enabled", "min-version", "vars", "before"}
+
+// taskTrailingFieldOrder lists the common fields that go after the
+// task-specific fields.
+var taskTrailingFieldOrder = []string{"after"}
+
+// sourceFieldOrder is the canonical order of the source selection fields.
+var sourceFieldOrder = []string{"source", "exclude", "extensions", "ignore-files", "require"}
+
+// targetFieldOrder is the canonical order of the fields within the target
+// maps of binpack and glyph-names tasks.
+var targetFieldOrder = []string{"file", "entry", "content"}
+
+// taskTypeFieldOrder is the canonical order of the task-specific fields, it
+// follows the order in which the fields are documented.
+var taskTypeFieldOrder = map[string][]string{
+	"dir":          {"path", "if-missing", "if-exists", "var"},
+	"file":         {"target", "content"},
+	"binpack":      fieldList(sourceFieldOrder, "target"),
+	"binpack-file": {"source", "ident", "element-type", "hpp-target", "cpp-target", "namespace"},
+	"svgfont":      fieldList(sourceFieldOrder, "target", "html-preview", "first-codepoint", "height", "descent", "family"),
+	"ttf":          {"source", "target"},
+	"glyph-names":  {"source", "target"},
+	"embed-icon":   fieldList(sourceFieldOrder, "target"),
+	"win32-icon":   fieldList(sourceFieldOrder, "target"),
+	"vg-convert":   fieldList(sourceFieldOrder, "hpp-target", "cpp-target", "namespace"),
+	"load-vars":    {"source", "format", "prefix"},
+	"build-info":   {"hpp-target", "cpp-target", "namespace", "version", "timestamp", "git", "fields"},
+	"exec":         {"command", "args", "shell", "dir", "env", "inputs", "outputs", "timeout", "capture"},
+	"copy":         fieldList(sourceFieldOrder, "target", "base", "rename", "overwrite", "preserve-mode"),
+	"remove":       {"paths", "preview"},
+	"archive":      fieldList(sourceFieldOrder, "target", "format", "base", "prefix", "timestamp", "level"),
+	"checksum":     fieldList(sourceFieldOrder, "target", "algorithm", "format", "base"),
+	"concat":       fieldList(sourceFieldOrder, "target", "header", "separator", "footer", "unique", "line-endings"),
+	"replace":      fieldList(sourceFieldOrder, "rules"),
+}
+
+func fieldList(a []string, b ...string) []string {
+	return append(append([]string{}, a...), b...)
+}
+
+// sortMapping reorders the key-value pairs within the mapping node, the keys
+// listed in order go first, the remaining keys keep their relative order.
+func sortMapping(m *yaml.Node, order ...[]string) {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return
+	}
+	rank := map[string]int{}
+	for _, keys := range order {
+		for _, k := range keys {
+			if _, exists := rank[k]; !exists {
+				rank[k] = len(rank)
+			}
+		}
+	}
+	type pair struct{ k, v *yaml.Node }
+	pairs := []pair{}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		pairs = append(pairs, pair{m.Content[i], m.Content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		ri, ok := rank[pairs[i].k.Value]
+		if !ok {
+			ri = len(rank)
+		}
+		rj, ok := rank[pairs[j].k.Value]
+		if !ok {
+			rj = len(rank)
+		}
+		return ri < rj
+	})
+	m.Content = m.Content[:0]
+	for _, p := range pairs {
+		m.Content = append(m.Content, p.k, p.v)
+	}
+}
+
+// FormatProject rewrites the content of a project file into the canonical
+// layout: the top-level fields, the task fields, and the target fields are
+// sorted in their declared order; the scalars use plain style unless quoting
+// is required, and the multi-line strings use literal style. Comments are
+// preserved.
+func FormatProject(buf []byte) ([]byte, error) {
+	doc, err := parseProjectNode(buf)
+	if err != nil {
+		return nil, err
+	}
+	blockStyle(doc)
+
+	root := doc.Content[0]
+	sortMapping(root, projectFieldOrder)
+
+	formatTasks(mappingValue(root, "tasks"))
+
+	return encodeProjectNode(doc)
+}
+
+// formatTasks sorts the fields within the task list, including the nested
+// before and after hooks.
+func formatTasks(tasks *yaml.Node) {
+	if tasks == nil || tasks.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, t := range tasks.Content {
+		typ := ""
+		if v := mappingValue(t, "type"); v != nil {
+			typ = v.Value
+		}
+		sortMapping(t, taskFieldOrder, taskTypeFieldOrder[typ], taskTrailingFieldOrder)
+
+		target := mappingValue(t, "target")
+		if target != nil && target.Kind == yaml.SequenceNode {
+			for _, item := range target.Content {
+				sortMapping(item, targetFieldOrder)
+			}
+		} else {
+			sortMapping(target, targetFieldOrder)
+		}
+
+		formatTasks(mappingValue(t, "before"))
+		formatTasks(mappingValue(t, "after"))
+	}
+}
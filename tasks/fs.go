@@ -0,0 +1,277 @@
+package tasks
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// FS is the filesystem used by the tasks for reading sources and writing
+// targets. All the paths passed to FS methods are absolute.
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(path string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	Glob(pattern string) ([]string, error)
+}
+
+// OSFS implements FS with the functions from the os package.
+type OSFS struct{}
+
+func (OSFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OSFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (OSFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFS) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (OSFS) Glob(pattern string) ([]string, error) {
+	return doublestar.FilepathGlob(pattern)
+}
+
+func (OSFS) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+// chmodFS is implemented by the filesystems that support changing the
+// permissions of the files.
+type chmodFS interface {
+	Chmod(name string, mode fs.FileMode) error
+}
+
+// MemFS is an in-memory implementation of FS, it is useful for testing
+// projects without touching the actual filesystem. The zero value is an
+// empty filesystem ready to use.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memEntry
+}
+
+type memEntry struct {
+	name    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (e *memEntry) Name() string               { return e.name }
+func (e *memEntry) Size() int64                { return int64(len(e.data)) }
+func (e *memEntry) Mode() fs.FileMode          { return e.mode }
+func (e *memEntry) ModTime() time.Time         { return e.modTime }
+func (e *memEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *memEntry) Sys() any                   { return nil }
+func (e *memEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *memEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+// memKey normalizes the name for use as a key in the MemFS entries. On
+// Windows, the volume name is kept as the first path element.
+func memKey(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+func (m *MemFS) entry(key string) *memEntry {
+	if m.files == nil {
+		m.files = map[string]*memEntry{}
+	}
+	if key == "/" || key == "." || (len(key) == 2 && key[1] == ':') {
+		return &memEntry{name: key, mode: fs.ModeDir | 0755}
+	}
+	return m.files[key]
+}
+
+func (m *MemFS) mkdirAll(key string, perm fs.FileMode) error {
+	for p := key; ; {
+		e := m.entry(p)
+		if e != nil {
+			if !e.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: fs.ErrExist}
+			}
+			return nil
+		}
+		m.files[p] = &memEntry{name: path.Base(p), mode: fs.ModeDir | perm, modTime: time.Now()}
+		parent := path.Dir(p)
+		if parent == p {
+			return nil
+		}
+		p = parent
+	}
+}
+
+// ReadFile returns the content of the file.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry(memKey(name))
+	if e == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	} else if e.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	return append([]byte{}, e.data...), nil
+}
+
+// WriteFile writes the file, creating all its parent directories.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memKey(name)
+	if e := m.entry(key); e != nil && e.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	err := m.mkdirAll(path.Dir(key), 0755)
+	if err != nil {
+		return err
+	}
+	m.files[key] = &memEntry{
+		name:    path.Base(key),
+		data:    append([]byte{}, data...),
+		mode:    perm,
+		modTime: time.Now(),
+	}
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry(memKey(name))
+	if e == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memKey(name)
+	e := m.entry(key)
+	if e == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	} else if !e.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	ret := []fs.DirEntry{}
+	for k, e := range m.files {
+		if path.Dir(k) == key && k != key {
+			ret = append(ret, e)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name() < ret[j].Name()
+	})
+	return ret, nil
+}
+
+func (m *MemFS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(memKey(path), perm)
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memKey(name)
+	e := m.entry(key)
+	if e == nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.IsDir() {
+		for k := range m.files {
+			if strings.HasPrefix(k, key+"/") {
+				return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+			}
+		}
+	}
+	delete(m.files, key)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memKey(path)
+	m.entry(key)
+	for k := range m.files {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			delete(m.files, k)
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry(memKey(name))
+	if e == nil {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrNotExist}
+	}
+	e.mode = e.mode.Type() | mode.Perm()
+	return nil
+}
+
+// Glob returns the names of all the entries matching the doublestar pattern.
+func (m *MemFS) Glob(pattern string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pattern = filepath.ToSlash(pattern)
+	if !doublestar.ValidatePattern(pattern) {
+		return nil, doublestar.ErrBadPattern
+	}
+	ret := []string{}
+	for k := range m.files {
+		if ok, _ := doublestar.Match(pattern, k); ok {
+			ret = append(ret, filepath.FromSlash(k))
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Files returns the sorted names of all the regular files.
+func (m *MemFS) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := []string{}
+	for k, e := range m.files {
+		if !e.IsDir() {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
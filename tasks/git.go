@@ -0,0 +1,106 @@
+package tasks
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// gitVars lists the variables computed by invoking git in the project
+// directory, along with their fallback values used outside of repositories.
+var gitVars = map[string]string{
+	"git-commit":       "unknown",
+	"git-commit-short": "unknown",
+	"git-describe":     "unknown",
+	"git-branch":       "unknown",
+	"git-dirty":        "false",
+}
+
+// IsGitVar reports whether the variable is computed with git.
+func IsGitVar(name string) bool {
+	_, ok := gitVars[name]
+	return ok
+}
+
+// provideVars computes the lazily evaluated variables referenced within v (a
+// string, or nested maps and arrays of strings) unless they are already
+// defined.
+func (prj *Project) provideVars(v any) {
+	switch v := v.(type) {
+	case string:
+		for _, m := range dollar_curly_re.FindAllStringSubmatch(v, -1) {
+			name := m[1]
+			if _, exists := prj.Vars[name]; !exists && IsGitVar(name) {
+				prj.loadGitVars()
+			}
+		}
+	case []any:
+		for _, item := range v {
+			prj.provideVars(item)
+		}
+	case map[string]any:
+		for _, item := range v {
+			prj.provideVars(item)
+		}
+	}
+}
+
+// loadGitVars defines the git variables that are not defined yet. When git is
+// not available or the project is not inside a repository, the fallback
+// values are used.
+func (prj *Project) loadGitVars() {
+	values := map[string]string{}
+	commit, err := prj.git("rev-parse", "HEAD")
+	if err == nil {
+		values["git-commit"] = commit
+		values["git-commit-short"], err = prj.git("rev-parse", "--short", "HEAD")
+	}
+	if err == nil {
+		values["git-describe"], err = prj.git("describe", "--tags", "--always", "--dirty")
+	}
+	if err == nil {
+		values["git-branch"], err = prj.git("rev-parse", "--abbrev-ref", "HEAD")
+	}
+	if err == nil {
+		var status string
+		status, err = prj.git("status", "--porcelain", "--untracked-files=no")
+		values["git-dirty"] = "false"
+		if status != "" {
+			values["git-dirty"] = "true"
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			prj.Printf("- WARNING: git is not available, using fallback values for the git variables\n")
+		} else {
+			prj.Printf("- WARNING: %s is not inside a git repository (%s), using fallback values for the git variables\n",
+				prj.BaseDir, err)
+		}
+		values = gitVars
+	}
+
+	for k, v := range values {
+		if _, exists := prj.Vars[k]; !exists {
+			prj.Vars[k] = v
+		}
+	}
+}
+
+// git runs the git command in the project directory and returns its trimmed
+// output.
+func (prj *Project) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = prj.BaseDir
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultLockTimeout is the default amount of time to wait for other btr
+// processes to release the project lock.
+const DefaultLockTimeout = 5 * time.Minute
+
+var errLockBusy = errors.New("lock is held by another process")
+
+// pathHash produces a short digest of a path, it is used for making names
+// that are unique per project.
+func pathHash(path string) string {
+	sum := sha256.Sum256([]byte(filepath.ToSlash(path)))
+	return hex.EncodeToString(sum[:6])
+}
+
+// TempDir returns the default temporary directory, it is unique per output
+// directory, so that it is guarded by the same lock as the outputs.
+func (prj *Project) TempDir() string {
+	return filepath.Join(os.TempDir(), "btr-"+pathHash(prj.OutDir))
+}
+
+func (prj *Project) lockFile() string {
+	return filepath.Join(os.TempDir(), "btr-"+pathHash(prj.OutDir)+".lock")
+}
+
+// Lock takes an advisory lock on the output directory of the project,
+// preventing concurrent btr processes from racing on the same outputs. When
+// the lock is held by another process, Lock waits for up to timeout before
+// giving up. The returned function releases the lock and removes the lock
+// file.
+func (prj *Project) Lock(timeout time.Duration) (func(), error) {
+	fn := prj.lockFile()
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		f, err := os.OpenFile(fn, os.O_CREATE|os.O_RDWR, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock file: %w", err)
+		}
+		err = lockFile(f)
+		if err == nil {
+			if !lockFileCurrent(f, fn) {
+				// the holder removed the file while we were waiting for it,
+				// start over with a fresh one
+				unlockFile(f)
+				f.Close()
+				continue
+			}
+			if prj.Verbose {
+				prj.Printf("acquired lock: %s\n", fn)
+			}
+			return func() {
+				// removed while still locked, so that the processes waiting
+				// on this file notice it is gone; on Windows the removal of
+				// an open file fails and the file is simply left in place
+				os.Remove(fn)
+				unlockFile(f)
+				f.Close()
+			}, nil
+		}
+		f.Close()
+		if !errors.Is(err, errLockBusy) {
+			return nil, fmt.Errorf("failed to lock %s: %w", fn, err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out after %s waiting for another btr process to finish with %s", timeout, prj.OutDir)
+		}
+		if !waiting {
+			waiting = true
+			prj.Printf("waiting for another btr process to finish with %s ...\n", prj.OutDir)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// lockFileCurrent reports whether the locked file is still the one found at
+// the lock file path.
+func lockFileCurrent(f *os.File, fn string) bool {
+	a, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	b, err := os.Stat(fn)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(a, b)
+}
@@ -0,0 +1,46 @@
+//go:build windows
+
+package tasks
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+
+	errorLockViolation syscall.Errno = 33
+)
+
+func lockFile(f *os.File) error {
+	ol := syscall.Overlapped{}
+	r, _, err := procLockFileEx.Call(f.Fd(),
+		lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0,
+		uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		if err == errorLockViolation || err == syscall.ERROR_IO_PENDING {
+			return errLockBusy
+		}
+		return err
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	ol := syscall.Overlapped{}
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0,
+		uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package tasks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// fieldAliases maps deprecated task field names to their canonical names.
+var fieldAliases = map[string]map[string]string{
+	"svgfont": {
+		"font-height":  "height",
+		"font-descent": "descent",
+		"family-name":  "family",
+	},
+}
+
+// parseProjectNode parses yaml (or json) content into a document node.
+func parseProjectNode(buf []byte) (*yaml.Node, error) {
+	doc := &yaml.Node{}
+	err := yaml.Unmarshal(buf, doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 ||
+		doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("the project must be a map")
+	}
+	return doc, nil
+}
+
+// encodeProjectNode produces yaml content with the project file indentation.
+func encodeProjectNode(doc *yaml.Node) ([]byte, error) {
+	buf := bytes.Buffer{}
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err := enc.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	if err != nil {
+		return nil, err
+	}
+	return spaceOut(buf.Bytes()), nil
+}
+
+// spaceOut separates the top-level sections and the items of the top-level
+// sequences (e.g. tasks) with blank lines, the encoder drops the blank lines
+// present in the original content. The comment lines preceding a section
+// or an item stay attached to it.
+func spaceOut(buf []byte) []byte {
+	lines := strings.Split(string(buf), "\n")
+	ret := make([]string, 0, len(lines))
+	for _, ln := range lines {
+		separate := len(ret) > 0 && ln != "" && ln[0] != ' ' && ln[0] != '#'
+		separate = separate || strings.HasPrefix(ln, "  - ")
+		if separate {
+			// insert before the comments attached to this line
+			n := len(ret)
+			for n > 0 && strings.HasPrefix(strings.TrimLeft(ret[n-1], " "), "#") &&
+				indentOf(ret[n-1]) == indentOf(ln) {
+				n--
+			}
+			if n > 0 && ret[n-1] != "" && !strings.HasSuffix(ret[n-1], ":") {
+				ret = append(ret[:n], append([]string{""}, ret[n:]...)...)
+			}
+		}
+		ret = append(ret, ln)
+	}
+	return []byte(strings.Join(ret, "\n"))
+}
+
+func indentOf(ln string) int {
+	return len(ln) - len(strings.TrimLeft(ln, " "))
+}
+
+func isVersionConstraint(s string) bool {
+	_, err := ParseVersionConstraint(s)
+	return err == nil
+}
+
+// mappingValue returns the value node for the key within a mapping node.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// blockStyle converts the json-style (flow) collections and quoted strings
+// into the regular yaml block style.
+func blockStyle(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!str" && strings.Contains(n.Value, "\n") {
+			n.Style = yaml.LiteralStyle
+		} else {
+			n.Style = 0
+		}
+	case yaml.MappingNode, yaml.SequenceNode:
+		n.Style = 0
+	}
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// MigrateProject upgrades the content of a project file (yaml, or legacy
+// json) to the current format: the deprecated field aliases are renamed to
+// their canonical names and the version field is bumped to the specified
+// version. Comments are preserved. Returns the new content in yaml format and
+// the descriptions of the changes made.
+func MigrateProject(buf []byte, version string) ([]byte, []string, error) {
+	doc, err := parseProjectNode(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := doc.Content[0]
+	changes := []string{}
+
+	if root.Style&yaml.FlowStyle != 0 {
+		blockStyle(doc)
+		changes = append(changes, "converted to yaml")
+	}
+
+	if version != "" {
+		newver, err := semver.ParseTolerant(version)
+		if err != nil {
+			return nil, nil, fmt.Errorf("version syntax in '%s': %w", version, err)
+		}
+		v := mappingValue(root, "version")
+		if v == nil {
+			root.Content = append([]*yaml.Node{
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"},
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: newver.String()},
+			}, root.Content...)
+			changes = append(changes, fmt.Sprintf("version: added %s", newver))
+		} else if oldver, err := semver.ParseTolerant(v.Value); (err == nil && oldver.LT(newver)) ||
+			(err != nil && !isVersionConstraint(v.Value)) {
+			// the constraint ranges are left as is
+			changes = append(changes, fmt.Sprintf("version: %s -> %s", v.Value, newver))
+			v.Value = newver.String()
+			v.Tag = "!!str"
+			v.Style = 0
+		}
+	}
+
+	if tasks := mappingValue(root, "tasks"); tasks != nil && tasks.Kind == yaml.SequenceNode {
+		for i, t := range tasks.Content {
+			typ := mappingValue(t, "type")
+			if typ == nil {
+				continue
+			}
+			aliases := fieldAliases[typ.Value]
+			for j := 0; j+1 < len(t.Content); j += 2 {
+				k := t.Content[j]
+				if canonical, ok := aliases[k.Value]; ok {
+					if mappingValue(t, canonical) != nil {
+						return nil, nil, fmt.Errorf("task[%d]: both '%s' and '%s' are specified", i, k.Value, canonical)
+					}
+					changes = append(changes, fmt.Sprintf("task[%d]: %s -> %s", i, k.Value, canonical))
+					k.Value = canonical
+				}
+			}
+		}
+	}
+
+	out, err := encodeProjectNode(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, changes, nil
+}
@@ -0,0 +1,230 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// PluginPrefix is prepended to the task type to get the name of the plugin
+// executable looked up in PATH.
+const PluginPrefix = "btr-task-"
+
+// PluginProtocol is the version of the plugin protocol.
+const PluginProtocol = 1
+
+// PluginRequest is written as JSON to the stdin of a plugin.
+type PluginRequest struct {
+	Protocol int               `json:"protocol"`
+	Type     string            `json:"type"`
+	Name     string            `json:"name,omitempty"`
+	BaseDir  string            `json:"base-dir"`
+	OutDir   string            `json:"out-dir"`
+	Verbose  bool              `json:"verbose"`
+	Fields   map[string]any    `json:"fields"`
+	Vars     map[string]string `json:"vars"`
+}
+
+// PluginResponse is read as JSON from the stdout of a plugin.
+type PluginResponse struct {
+	Outputs     []string           `json:"outputs"` // relative to the output directory
+	Exports     map[string]string  `json:"exports"`
+	Diagnostics []PluginDiagnostic `json:"diagnostics"`
+}
+
+// PluginDiagnostic is a message reported by a plugin.
+type PluginDiagnostic struct {
+	Level   string `json:"level"` // info, warning, or error
+	Message string `json:"message"`
+}
+
+// PluginTask runs an external executable that implements a task type.
+type PluginTask struct {
+	Type string
+	Path string
+	Name string
+}
+
+// findPlugin returns the path to the executable implementing the task type:
+// either declared in the plugins section of the project or found in PATH as
+// btr-task-<type>. Returns an empty string if there is none.
+func (prj *Project) findPlugin(typ string) (string, error) {
+	if s, ok := prj.Plugins[typ]; ok {
+		fn, err := prj.AbsPath(s)
+		if err != nil {
+			return "", fmt.Errorf("plugins: %s: %w", typ, err)
+		}
+		fn, err = exec.LookPath(filepath.FromSlash(fn))
+		if err != nil {
+			return "", fmt.Errorf("plugins: %s: %w", typ, err)
+		}
+		return fn, nil
+	}
+	if !ident_re.MatchString(typ) {
+		return "", nil
+	}
+	fn, err := exec.LookPath(PluginPrefix + typ)
+	if err != nil {
+		return "", nil
+	}
+	return fn, nil
+}
+
+func (t PluginTask) Run(prj *Project, fields map[string]any) error {
+	if _, ok := prj.fsys().(OSFS); !ok {
+		return fmt.Errorf("plugins can only be used with the OS filesystem")
+	}
+
+	resolved, err := resolveFields(prj, fields)
+	if err != nil {
+		return err
+	}
+	req := &PluginRequest{
+		Protocol: PluginProtocol,
+		Type:     t.Type,
+		Name:     t.Name,
+		BaseDir:  filepath.ToSlash(prj.BaseDir),
+		OutDir:   prj.OutDir,
+		Verbose:  prj.Verbose,
+		Fields:   resolved.(map[string]any),
+		Vars:     prj.Vars,
+	}
+	stdin, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	if prj.Verbose {
+		prj.Printf("- plugin: %s\n", t.Path)
+	}
+	cmd := exec.Command(t.Path)
+	cmd.Dir = prj.BaseDir
+	cmd.Stdin = bytes.NewReader(stdin)
+	stdout := bytes.Buffer{}
+	cmd.Stdout = &stdout
+	cmd.Stderr = prj.logWriter()
+	end_phase := prj.phase("exec")
+	exec_err := cmd.Run()
+	end_phase()
+
+	// the diagnostics of a failed plugin are still reported, they usually
+	// explain the failure
+	resp := &PluginResponse{}
+	if s := bytes.TrimSpace(stdout.Bytes()); len(s) > 0 {
+		err = json.Unmarshal(s, resp)
+		if err != nil && exec_err == nil {
+			return fmt.Errorf("plugin %s: invalid response: %w", filepath.Base(t.Path), err)
+		}
+	}
+
+	failed := false
+	for _, d := range resp.Diagnostics {
+		switch strings.ToLower(d.Level) {
+		case "error":
+			failed = true
+			prj.Printf("- ERROR: %s\n", d.Message)
+		case "warning":
+			prj.Printf("- WARNING: %s\n", d.Message)
+		default:
+			prj.Printf("- %s\n", d.Message)
+		}
+	}
+	if exec_err != nil {
+		return fmt.Errorf("plugin %s: %w", filepath.Base(t.Path), exec_err)
+	} else if failed {
+		return errors.New("the plugin reported errors")
+	}
+
+	outputs := []string{}
+	for _, s := range resp.Outputs {
+		fn, err := prj.AbsTargetPath(s)
+		if err != nil {
+			return fmt.Errorf("plugin output %s: %w", s, err)
+		}
+		outputs = append(outputs, fn)
+	}
+	err = prj.recordOutputs(outputs)
+	if err != nil {
+		return err
+	}
+	for _, fn := range outputs {
+		prj.Printf("- written %s\n", fn)
+	}
+
+	names := maps.Keys(resp.Exports)
+	sort.Strings(names)
+	for _, name := range names {
+		prj.Export(name, resp.Exports[name])
+	}
+	return nil
+}
+
+var escaped_placeholder_re = regexp.MustCompile(`\$\$\{[^}]*\}`)
+
+// resolveFields expands the variables in all the strings within the field
+// values. The escaped $${...} placeholders are passed to the plugin as ${...}.
+func resolveFields(prj *Project, v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		parts := strings.Split(v, "$${")
+		for i, s := range parts {
+			s, err := ExpandVariables(s, prj.Vars)
+			if err != nil {
+				return nil, err
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, "${"), nil
+	case []any:
+		ret := make([]any, len(v))
+		for i, item := range v {
+			r, err := resolveFields(prj, item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			ret[i] = r
+		}
+		return ret, nil
+	case map[string]any:
+		ret := make(map[string]any, len(v))
+		for k, item := range v {
+			r, err := resolveFields(prj, item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			ret[k] = r
+		}
+		return ret, nil
+	}
+	return v, nil
+}
+
+// stripPluginEscapes removes the escaped $${...} placeholders from the field
+// values, they are not variable references.
+func stripPluginEscapes(v any) any {
+	switch v := v.(type) {
+	case string:
+		return escaped_placeholder_re.ReplaceAllString(v, "")
+	case []any:
+		ret := make([]any, len(v))
+		for i, item := range v {
+			ret[i] = stripPluginEscapes(item)
+		}
+		return ret
+	case map[string]any:
+		ret := make(map[string]any, len(v))
+		for k, item := range v {
+			ret[k] = stripPluginEscapes(item)
+		}
+		return ret
+	}
+	return v
+}
@@ -0,0 +1,244 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ProfilePhases lists the sub-phases reported in the profile, in the order of
+// the report columns. The time spent within a task outside of the phases is
+// reported as 'other'.
+var ProfilePhases = []string{"read", "decode", "encode", "exec", "write"}
+
+// Profile collects the timings of the tasks while the project is running.
+type Profile struct {
+	Tasks []*TaskProfile
+
+	start  time.Time
+	stack  []*TaskProfile
+	events []traceEvent
+}
+
+// TaskProfile contains the timings of a single task, the hooks are profiled
+// as separate tasks with a greater depth.
+type TaskProfile struct {
+	Name         string
+	Type         string
+	Depth        int
+	Start        time.Time
+	Duration     time.Duration
+	Phases       map[string]time.Duration // exclusive time spent in the phases
+	BytesRead    int64
+	BytesWritten int64
+
+	spans []*phaseSpan
+}
+
+type phaseSpan struct {
+	name    string
+	start   time.Time
+	resumed time.Time
+}
+
+// traceEvent is a complete event in the Chrome trace event format.
+type traceEvent struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat"`
+	Ph   string         `json:"ph"`
+	Ts   int64          `json:"ts"`  // microseconds
+	Dur  int64          `json:"dur"` // microseconds
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// NewProfile creates an empty profile, assign it to Project.Profile to enable
+// profiling.
+func NewProfile() *Profile {
+	return &Profile{start: time.Now()}
+}
+
+func (p *Profile) current() *TaskProfile {
+	if p == nil || len(p.stack) == 0 {
+		return nil
+	}
+	return p.stack[len(p.stack)-1]
+}
+
+func (p *Profile) event(name, cat string, start time.Time, d time.Duration, args map[string]any) {
+	p.events = append(p.events, traceEvent{
+		Name: name,
+		Cat:  cat,
+		Ph:   "X",
+		Ts:   start.Sub(p.start).Microseconds(),
+		Dur:  d.Microseconds(),
+		Pid:  1,
+		Tid:  1,
+		Args: args,
+	})
+}
+
+// profileTask starts profiling a task, the returned function stops it.
+func (prj *Project) profileTask(t *Task) func() {
+	p := prj.Profile
+	if p == nil {
+		return func() {}
+	}
+	name := t.Name
+	if name == "" {
+		name = t.Type
+	}
+	tp := &TaskProfile{
+		Name:   name,
+		Type:   t.Type,
+		Depth:  len(p.stack),
+		Start:  time.Now(),
+		Phases: map[string]time.Duration{},
+	}
+	p.Tasks = append(p.Tasks, tp)
+	p.stack = append(p.stack, tp)
+	return func() {
+		for len(tp.spans) > 0 {
+			prj.endPhase(tp)
+		}
+		tp.Duration = time.Since(tp.Start)
+		p.stack = p.stack[:len(p.stack)-1]
+		p.event(tp.Name, "task", tp.Start, tp.Duration, map[string]any{
+			"type":          tp.Type,
+			"bytes-read":    tp.BytesRead,
+			"bytes-written": tp.BytesWritten,
+		})
+	}
+}
+
+// phase starts timing a sub-phase of the running task, the returned function
+// ends it. The time of the nested phases is not included in the enclosing
+// phase.
+func (prj *Project) phase(name string) func() {
+	tp := prj.Profile.current()
+	if tp == nil {
+		return func() {}
+	}
+	now := time.Now()
+	if n := len(tp.spans); n > 0 {
+		outer := tp.spans[n-1]
+		tp.Phases[outer.name] += now.Sub(outer.resumed)
+	}
+	span := &phaseSpan{name: name, start: now, resumed: now}
+	tp.spans = append(tp.spans, span)
+	return func() {
+		// the span may have been closed when the task was stopped
+		if n := len(tp.spans); n > 0 && tp.spans[n-1] == span {
+			prj.endPhase(tp)
+		}
+	}
+}
+
+func (prj *Project) endPhase(tp *TaskProfile) {
+	now := time.Now()
+	n := len(tp.spans)
+	span := tp.spans[n-1]
+	tp.spans = tp.spans[:n-1]
+	tp.Phases[span.name] += now.Sub(span.resumed)
+	prj.Profile.event(span.name, "phase", span.start, now.Sub(span.start), nil)
+	if n > 1 {
+		tp.spans[n-2].resumed = now
+	}
+}
+
+func (prj *Project) profileRead(n int) {
+	if tp := prj.Profile.current(); tp != nil {
+		tp.BytesRead += int64(n)
+	}
+}
+
+func (prj *Project) profileWrite(n int) {
+	if tp := prj.Profile.current(); tp != nil {
+		tp.BytesWritten += int64(n)
+	}
+}
+
+// WriteReport prints the per-task timings as a table.
+func (p *Profile) WriteReport(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "task\ttime\t%s\tother\tbytes read\tbytes written\n",
+		strings.Join(ProfilePhases, "\t"))
+	total := time.Duration(0)
+	for _, tp := range p.Tasks {
+		if tp.Depth == 0 {
+			total += tp.Duration
+		}
+		other := tp.Duration
+		cols := []string{}
+		for _, name := range ProfilePhases {
+			d := tp.Phases[name]
+			other -= d
+			cols = append(cols, formatProfileDuration(d))
+		}
+		other -= p.nestedDuration(tp)
+		fmt.Fprintf(tw, "%s%s\t%s\t%s\t%s\t%s\t%s\n",
+			strings.Repeat("  ", tp.Depth), tp.Name,
+			formatProfileDuration(tp.Duration),
+			strings.Join(cols, "\t"),
+			formatProfileDuration(max(other, 0)),
+			formatByteCount(tp.BytesRead),
+			formatByteCount(tp.BytesWritten))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "total: %s\n", formatProfileDuration(total))
+}
+
+// nestedDuration returns the time spent in the hooks of the task.
+func (p *Profile) nestedDuration(tp *TaskProfile) time.Duration {
+	ret := time.Duration(0)
+	end := tp.Start.Add(tp.Duration)
+	for _, h := range p.Tasks {
+		if h.Depth == tp.Depth+1 && !h.Start.Before(tp.Start) && !h.Start.After(end) {
+			ret += h.Duration
+		}
+	}
+	return ret
+}
+
+// WriteTrace writes the collected timings in the Chrome trace event format,
+// the file can be opened with chrome://tracing or https://ui.perfetto.dev.
+func (p *Profile) WriteTrace(w io.Writer) error {
+	events := p.events
+	if events == nil {
+		events = []traceEvent{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+}
+
+func formatProfileDuration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "-"
+	case d < time.Millisecond:
+		return fmt.Sprintf("%dµs", d.Microseconds())
+	case d < time.Second:
+		return fmt.Sprintf("%.1fms", float64(d.Microseconds())/1000)
+	}
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
+
+func formatByteCount(n int64) string {
+	switch {
+	case n == 0:
+		return "-"
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KiB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1024*1024))
+}
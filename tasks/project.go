@@ -3,32 +3,52 @@ package tasks
 import (
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/blang/semver/v4"
 	"github.com/bmatcuk/doublestar/v4"
+	"golang.org/x/exp/maps"
 	"gopkg.in/yaml.v3"
 )
 
 // Project contains global vars and tasks.
 type Project struct {
-	BaseDir string            `yaml:"-"`
-	Verbose bool              `yaml:"-"`
-	Version string            `yaml:"version"`
-	Vars    map[string]string `yaml:"vars"`
-	Tasks   []*Task           `yaml:"tasks"`
+	BaseDir   string            `yaml:"-"`
+	OutDir    string            `yaml:"-"`
+	Verbose   bool              `yaml:"-"`
+	FS        FS                `yaml:"-"` // defaults to OSFS
+	Log       io.Writer         `yaml:"-"` // defaults to os.Stdout
+	Profile   *Profile          `yaml:"-"` // collects the task timings when assigned
+	Version   string            `yaml:"version"`
+	OutputDir string            `yaml:"output-dir,omitempty"`
+	Plugins   map[string]string `yaml:"plugins,omitempty"` // task type -> executable
+	VarsFrom  []*VarsSource     `yaml:"vars-from,omitempty"`
+	Vars      map[string]string `yaml:"vars"`
+	Tasks     []*Task           `yaml:"tasks"`
+
+	state      *State
+	outputs    []string
+	appVersion *semver.Version // set by ValidateVersion
+	exportID   string          // id of the running task
 }
 
 // Task
 type Task struct {
-	Name    string         `yaml:"name,omitempty"`
-	Type    string         `yaml:"type,omitempty"`
-	Enabled *bool          `yaml:"enabled,omitempty"`
-	Fields  map[string]any `yaml:",inline"`
+	Name       string            `yaml:"name,omitempty"`
+	Type       string            `yaml:"type,omitempty"`
+	ID         string            `yaml:"id,omitempty"` // prefix for the exported variables
+	Enabled    *bool             `yaml:"enabled,omitempty"`
+	MinVersion string            `yaml:"min-version,omitempty"`
+	Vars       map[string]string `yaml:"vars,omitempty"`   // visible only within the task and its hooks
+	Before     []*Task           `yaml:"before,omitempty"` // tasks to run before this task
+	After      []*Task           `yaml:"after,omitempty"`  // tasks to run after this task
+	Fields     map[string]any    `yaml:",inline"`
 }
 
 func LoadProject(fn string) (*Project, error) {
@@ -36,39 +56,132 @@ func LoadProject(fn string) (*Project, error) {
 	if err != nil {
 		return nil, err
 	}
-	prj := &Project{}
 	ext := strings.ToLower(filepath.Ext(fn))
-	if ext == ".yaml" || ext == ".yml" {
-		err = yaml.Unmarshal(buf, &prj)
-	} else if ext == ".json" {
+	if ext == ".json" {
 		return nil, fmt.Errorf("json format is no longer supported")
-	} else {
+	} else if ext != ".yaml" && ext != ".yml" {
 		return nil, fmt.Errorf("only files with .yaml and .yml extensions are supported")
 	}
+	prj, err := ParseProject(buf, filepath.Dir(fn))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config from %q:\n%s",
 			fn, err)
 	}
-	prj.BaseDir, err = filepath.Abs(filepath.Dir(fn))
+	return prj, nil
+}
+
+// ParseProject constructs a project from the yaml content, the relative
+// paths within the project are expanded relative to baseDir.
+func ParseProject(buf []byte, baseDir string) (*Project, error) {
+	return ParseProjectFS(buf, baseDir, nil)
+}
+
+// ParseProjectFS is like ParseProject, but the project uses the specified
+// filesystem, including for reading the vars-from files.
+func ParseProjectFS(buf []byte, baseDir string, fsys FS) (*Project, error) {
+	prj := &Project{FS: fsys}
+	err := yaml.Unmarshal(buf, &prj)
 	if err != nil {
-		return nil, fmt.Errorf("config error: %w", err)
+		return nil, err
+	}
+	err = prj.Init(baseDir)
+	if err != nil {
+		return nil, err
 	}
 	return prj, nil
 }
 
+// Init prepares a project that was constructed in code for running, the
+// relative paths within the project are expanded relative to baseDir. The
+// variables from the vars-from files are loaded here, once per project, so the
+// FS field must be set before calling Init.
+func (prj *Project) Init(baseDir string) error {
+	var err error
+	prj.BaseDir, err = filepath.Abs(baseDir)
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	if prj.Vars == nil {
+		prj.Vars = map[string]string{}
+	}
+	for i, src := range prj.VarsFrom {
+		_, err = prj.LoadVars(src)
+		if err != nil {
+			return fmt.Errorf("vars-from[%d]: %w", i, err)
+		}
+	}
+	if _, exists := prj.Vars["out-dir"]; exists {
+		return fmt.Errorf("vars: 'out-dir' is reserved for the output directory, use the output-dir field instead")
+	}
+	err = prj.SetOutDir(prj.OutputDir)
+	if err != nil {
+		return fmt.Errorf("output-dir: %w", err)
+	}
+	return nil
+}
+
+// Printf writes a message to the project log.
+func (prj *Project) Printf(format string, args ...any) {
+	fmt.Fprintf(prj.logWriter(), format, args...)
+}
+
+func (prj *Project) logWriter() io.Writer {
+	if prj.Log == nil {
+		return os.Stdout
+	}
+	return prj.Log
+}
+
+func (prj *Project) fsys() FS {
+	if prj.FS == nil {
+		return OSFS{}
+	}
+	return prj.FS
+}
+
+// ReadFile reads a source file.
+func (prj *Project) ReadFile(fn string) ([]byte, error) {
+	defer prj.phase("read")()
+	data, err := prj.fsys().ReadFile(fn)
+	prj.profileRead(len(data))
+	return data, err
+}
+
+// Outputs returns the paths of the files produced by the last run.
+func (prj *Project) Outputs() []string {
+	return prj.outputs
+}
+
+// SetOutDir assigns the base directory for the target paths and exposes it as
+// the ${out-dir} variable. A relative dir is expanded relative to BaseDir, an
+// empty dir resets the output to BaseDir.
+func (prj *Project) SetOutDir(dir string) error {
+	if dir == "" {
+		prj.OutDir = filepath.ToSlash(prj.BaseDir)
+	} else {
+		p, err := prj.AbsPath(dir)
+		if err != nil {
+			return err
+		}
+		prj.OutDir = p
+	}
+	prj.Vars["out-dir"] = prj.OutDir
+	return nil
+}
+
 func (prj *Project) ValidateVersion(appver string) error {
 	if appver == "(devel)" || appver == "#UNAVAILABLE" {
 		if prj.Verbose {
-			fmt.Printf("skipping version check: running devel build")
+			prj.Printf("skipping version check: running devel build\n")
 		}
 		return nil
 	}
 
 	if prj.Version == "" {
-		fmt.Printf("WARNING: skipping version check: missing version field in the project file")
+		prj.Printf("WARNING: skipping version check: missing version field in the project file\n")
 		return nil
 	}
-	projsemver, err := semver.ParseTolerant(prj.Version)
+	constraint, err := ParseVersionConstraint(prj.Version)
 	if err != nil {
 		return fmt.Errorf("version synax in '%s': %w", prj.Version, err)
 	}
@@ -77,30 +190,59 @@ func (prj *Project) ValidateVersion(appver string) error {
 	if err != nil {
 		return fmt.Errorf("version check: failed to parse app version '%s'", appver)
 	}
+	prj.appVersion = &appsemver
 
-	if projsemver.Compare(appsemver) > 0 {
-		fmt.Printf("btr version >= %s is required to execute these tasks\n", projsemver)
-		fmt.Printf("you are using version %s\n", appsemver)
-		fmt.Printf("please update btr, see https://github.com/adnsv/btr for details\n")
-		fmt.Printf("execute the following line to update btr to its latest version:\n")
-		fmt.Printf("    go install github.com/adnsv/btr@latest\n")
+	if !constraint.Check(appsemver) {
+		prj.Printf("btr version %s is required to execute these tasks\n", constraint)
+		prj.Printf("you are using version %s\n", appsemver)
+		if appsemver.LT(constraint.Min()) {
+			prj.Printf("please update btr, see https://github.com/adnsv/btr for details\n")
+			prj.Printf("execute the following line to update btr to its latest version:\n")
+			prj.Printf("    go install github.com/adnsv/btr@latest\n")
+		} else {
+			prj.Printf("execute the following line to install a compatible version of btr:\n")
+			prj.Printf("    go install github.com/adnsv/btr@v%s\n", constraint.Min())
+		}
 		return fmt.Errorf("version check: unsupported version")
 	}
 
 	return nil
 }
 
-func (prj *Project) Run() error {
+func (prj *Project) Run() (err error) {
 	if len(prj.Tasks) == 0 {
 		return fmt.Errorf("no tasks specified")
 	}
+
+	err = validateTaskIDs(prj.Tasks, "task", map[string]bool{})
+	if err != nil {
+		return err
+	}
+	prj.checkProjectVersion()
+
+	prj.outputs = nil
+	prj.state, err = prj.LoadState()
+	if err != nil {
+		return err
+	}
+	err = prj.MkdirAll(prj.OutDir)
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	defer func() {
+		if e := prj.SaveState(prj.state); e != nil && err == nil {
+			err = fmt.Errorf("failed to save state: %w", e)
+		}
+		prj.state = nil
+	}()
+
 	for i, t := range prj.Tasks {
 		s := ""
 		if t.Name != "" {
 			s = fmt.Sprintf(": '%s'", t.Name)
 		}
-		fmt.Printf("Task %d of %d%s\n", i+1, len(prj.Tasks), s)
-		err := prj.RunTask(t)
+		prj.Printf("Task %d of %d%s\n", i+1, len(prj.Tasks), s)
+		err = prj.RunTask(t)
 		if err != nil {
 			s := fmt.Sprintf("task[%d]", i)
 			if t.Name != "" {
@@ -114,18 +256,39 @@ func (prj *Project) Run() error {
 
 func (prj *Project) RunTask(t *Task) error {
 	if t.Type == "" {
-		log.Printf("missing 'type' field\n")
+		prj.Printf("- WARNING: missing 'type' field\n")
 		return nil
 	}
 	if prj.Verbose {
-		fmt.Printf("- type: %s\n", t.Type)
+		prj.Printf("- type: %s\n", t.Type)
 	}
 
 	if t.Enabled != nil && !*t.Enabled {
-		fmt.Printf("  disabled\n")
+		prj.Printf("  disabled\n")
 		return nil
 	}
 
+	err := prj.checkTaskVersion(t)
+	if err != nil {
+		return err
+	}
+	defer prj.profileTask(t)()
+
+	if len(t.Vars) > 0 {
+		restore, err := prj.pushVars(t.Vars)
+		if err != nil {
+			return fmt.Errorf("vars: %w", err)
+		}
+		defer restore()
+	}
+
+	err = prj.runHooks("before", t.Before)
+	if err != nil {
+		return err
+	}
+
+	prj.provideVars(t.Fields)
+
 	var task interface {
 		Run(prj *Project, fields map[string]any) error
 	}
@@ -151,21 +314,155 @@ func (prj *Project) RunTask(t *Task) error {
 		task = Win32IconTask{}
 	case "vg-convert":
 		task = VGConvertTask{}
+	case "load-vars":
+		task = LoadVarsTask{}
+	case "build-info":
+		task = BuildInfoTask{}
+	case "exec":
+		task = ExecTask{}
+	case "copy":
+		task = CopyTask{}
+	case "remove":
+		task = RemoveTask{}
+	case "archive":
+		task = ArchiveTask{}
+	case "checksum":
+		task = ChecksumTask{}
+	case "concat":
+		task = ConcatTask{}
+	case "replace":
+		task = ReplaceTask{}
 	default:
-		log.Printf("unsupported type '%s'", t.Type)
-		return nil
+		plugin, err := prj.findPlugin(t.Type)
+		if err != nil {
+			return err
+		} else if plugin == "" {
+			prj.Printf("- WARNING: unsupported type '%s'\n", t.Type)
+			return nil
+		}
+		task = PluginTask{Type: t.Type, Path: plugin, Name: t.Name}
 	}
 
-	return task.Run(prj, t.Fields)
+	prev_id := prj.exportID
+	prj.exportID = t.ID
+	defer func() { prj.exportID = prev_id }()
+	first_output := len(prj.outputs)
+
+	err = task.Run(prj, t.Fields)
+	if err != nil {
+		return err
+	}
+
+	if files := prj.outputs[first_output:]; len(files) > 0 {
+		prj.Export("file", files[0])
+		prj.Export("files", strings.Join(files, "\n"))
+	}
+
+	return prj.runHooks("after", t.After)
+}
+
+// runHooks runs the before or after hooks of a task.
+func (prj *Project) runHooks(kind string, hooks []*Task) error {
+	for i, h := range hooks {
+		s := h.Type
+		if h.Name != "" {
+			s = fmt.Sprintf("'%s'", h.Name)
+		}
+		prj.Printf("- %s: %s\n", kind, s)
+		err := prj.RunTask(h)
+		if err != nil {
+			return fmt.Errorf("%s[%d]: %w", kind, i, err)
+		}
+	}
+	return nil
+}
+
+// pushVars layers the task-local variables over the project variables, the
+// values are expanded with the enclosing variables. The returned function
+// restores the enclosing variables, keeping the variables that were defined
+// while the local ones were in effect (e.g. by dir tasks or exports).
+func (prj *Project) pushVars(local map[string]string) (func(), error) {
+	names := maps.Keys(local)
+	sort.Strings(names)
+	for _, name := range names {
+		prj.provideVars(local[name])
+	}
+
+	outer := prj.Vars
+	scoped := maps.Clone(outer)
+	for _, name := range names {
+		if !var_name_re.MatchString(name) {
+			return nil, fmt.Errorf("'%s' is not a valid variable name", name)
+		}
+		v, err := ExpandVariables(local[name], outer)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		scoped[name] = v
+	}
+	prj.Vars = scoped
+
+	return func() {
+		for k, v := range scoped {
+			if _, isLocal := local[k]; !isLocal {
+				outer[k] = v
+			}
+		}
+		prj.Vars = outer
+	}, nil
+}
+
+// validateTaskIDs verifies that the task ids, including the ids of the
+// hooks, are valid and unique.
+func validateTaskIDs(tasks []*Task, kind string, ids map[string]bool) error {
+	for i, t := range tasks {
+		if t.ID != "" {
+			if !ident_re.MatchString(t.ID) {
+				return fmt.Errorf("%s[%d]: id: '%s' is not a valid identifier", kind, i, t.ID)
+			} else if ids[t.ID] {
+				return fmt.Errorf("%s[%d]: id: '%s' is already used by another task", kind, i, t.ID)
+			}
+			ids[t.ID] = true
+		}
+		err := validateTaskIDs(t.Before, "before", ids)
+		if err == nil {
+			err = validateTaskIDs(t.After, "after", ids)
+		}
+		if err != nil {
+			return fmt.Errorf("%s[%d]: %w", kind, i, err)
+		}
+	}
+	return nil
+}
+
+// Export publishes a result of the running task as the ${<id>.<name>}
+// variable, nothing is exported for the tasks without the id field.
+func (prj *Project) Export(name string, value string) {
+	if prj.exportID == "" {
+		return
+	}
+	key := prj.exportID + "." + name
+	prj.Vars[key] = value
+	if prj.Verbose {
+		prj.Printf("- exporting: ${%s}\n", key)
+	}
 }
 
 // AbsExistingPaths gets all the actual filepaths from sources, processes
 // wildcards, (including doublestar) and expands all paths relative to basedir
 // returns paths only for existing filesystem entries.
+//
+// Sources starting with ! are exclusion patterns, they are applied to the
+// paths matched by the other sources. An exclusion pattern that does not
+// contain slashes is matched against the file names, otherwise it is matched
+// against the full paths. An exclusion pattern ending with a slash excludes the
+// matching directories along with all their content, a plain directory name
+// followed by a slash matches the directories at any depth.
 func (prj *Project) AbsExistingPaths(sources []string) ([]string, error) {
 	var err error
 	ret := []string{}
 	set := map[string]struct{}{}
+	excludes := []string{}
 	for _, s := range sources {
 		if s == "" {
 			continue
@@ -175,6 +472,25 @@ func (prj *Project) AbsExistingPaths(sources []string) ([]string, error) {
 			return nil, err
 		}
 
+		if s[0] == '!' {
+			s = filepath.ToSlash(s[1:])
+			is_dir := strings.HasSuffix(s, "/")
+			if is_dir && !strings.Contains(strings.TrimSuffix(s, "/"), "/") {
+				// a directory name, at any depth
+				s = "**/" + s
+			} else if strings.Contains(s, "/") && !filepath.IsAbs(s) {
+				s = filepath.ToSlash(filepath.Join(prj.BaseDir, s))
+			}
+			if is_dir {
+				s = strings.TrimSuffix(s, "/") + "/**"
+			}
+			if !doublestar.ValidatePattern(s) {
+				return nil, fmt.Errorf("invalid exclusion pattern %q", s)
+			}
+			excludes = append(excludes, s)
+			continue
+		}
+
 		if !filepath.IsAbs(s) {
 			s, err = filepath.Abs(filepath.Join(prj.BaseDir, s))
 			if err != nil {
@@ -183,7 +499,7 @@ func (prj *Project) AbsExistingPaths(sources []string) ([]string, error) {
 			s = filepath.Clean(s)
 		}
 
-		matches, err := doublestar.FilepathGlob(s)
+		matches, err := prj.fsys().Glob(s)
 		if err != nil {
 			return nil, err
 		}
@@ -195,6 +511,20 @@ func (prj *Project) AbsExistingPaths(sources []string) ([]string, error) {
 			set[m] = struct{}{}
 		}
 	}
+	if len(excludes) > 0 {
+		ret = slices.DeleteFunc(ret, func(fn string) bool {
+			for _, x := range excludes {
+				target := fn
+				if !strings.Contains(x, "/") {
+					target = path.Base(fn)
+				}
+				if ok, _ := doublestar.Match(x, target); ok {
+					return true
+				}
+			}
+			return false
+		})
+	}
 	sort.Strings(ret)
 	return ret, nil
 }
@@ -216,6 +546,23 @@ func (prj *Project) AbsPath(path string) (string, error) {
 	return filepath.ToSlash(filepath.Clean(p)), nil
 }
 
+// AbsTargetPath converts path to absolute path
+// non-absolute path is expanded relative to the output dir.
+func (prj *Project) AbsTargetPath(path string) (string, error) {
+	path, err := ExpandVariables(path, prj.Vars)
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(path) {
+		return filepath.ToSlash(path), nil
+	}
+	p, err := filepath.Abs(filepath.Join(prj.OutDir, path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(filepath.Clean(p)), nil
+}
+
 func ValidateIdent(s string) (string, error) {
 	if s == "" {
 		return "", errors.New("invalid identifier: empty")
@@ -245,7 +592,7 @@ func (prj *Project) getTarget(m map[string]any) (*Target, error) {
 			if s, ok := v.(string); !ok || s == "" {
 				return nil, fmt.Errorf("%s: must be a non-empty string", k)
 			} else {
-				t.File, err = prj.AbsPath(s)
+				t.File, err = prj.AbsTargetPath(s)
 				if err != nil {
 					return nil, fmt.Errorf("%s: %w", k, err)
 				}
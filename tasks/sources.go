@@ -0,0 +1,301 @@
+package tasks
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// SourceSelection describes how the source files of a task are picked.
+type SourceSelection struct {
+	Patterns    []string // include patterns, entries starting with ! exclude
+	Exclude     []string // exclude patterns
+	Extensions  []string // lower-case extensions with a leading dot
+	IgnoreFiles []string // names of gitignore-style files to honor
+	MinCount    int      // minimum number of files
+	MaxCount    int      // maximum number of files, -1 for unlimited
+}
+
+// IsSourceField reports whether the task field is handled by GetSources.
+func IsSourceField(k string) bool {
+	switch k {
+	case "source", "exclude", "extensions", "ignore-files", "require":
+		return true
+	}
+	return false
+}
+
+// FetchSourceFields parses the source selection fields of a task.
+func FetchSourceFields(prj *Project, fields map[string]any) (*SourceSelection, error) {
+	sel := &SourceSelection{MinCount: 1, MaxCount: -1}
+
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "source":
+			sel.Patterns, err = prj.GetStrings(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+
+		case "exclude":
+			sel.Exclude, err = prj.GetStrings(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+
+		case "extensions":
+			exts, err := prj.GetStrings(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			for _, ext := range exts {
+				if ext == "" {
+					return nil, fmt.Errorf("%s: empty value is not allowed", k)
+				}
+				if ext[0] != '.' {
+					ext = "." + ext
+				}
+				sel.Extensions = append(sel.Extensions, strings.ToLower(ext))
+			}
+
+		case "ignore-files":
+			if b, ok := v.(bool); ok {
+				if b {
+					sel.IgnoreFiles = []string{".btrignore", ".gitignore"}
+				}
+			} else if sel.IgnoreFiles, err = prj.GetStrings(v); err != nil {
+				return nil, fmt.Errorf("%s: must be a boolean, a string, or an array of strings", k)
+			}
+
+		case "require":
+			sel.MinCount, sel.MaxCount, err = parseCountRequirement(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	}
+
+	if len(sel.Patterns) == 0 {
+		return nil, fmt.Errorf("missing field: source")
+	}
+	return sel, nil
+}
+
+// parseCountRequirement handles 'at-least N', 'at-most N', 'exactly N', and
+// plain integers (treated as 'at-least N').
+func parseCountRequirement(v any) (min, max int, err error) {
+	if n, ok := v.(int); ok && n >= 0 {
+		return n, -1, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return 0, 0, errors.New("must be 'at-least N', 'at-most N', or 'exactly N'")
+	}
+	kind, num, _ := strings.Cut(strings.TrimSpace(s), " ")
+	n, err := strconv.Atoi(strings.TrimSpace(num))
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("invalid count in %q", s)
+	}
+	switch kind {
+	case "at-least":
+		return n, -1, nil
+	case "at-most":
+		return 0, n, nil
+	case "exactly":
+		return n, n, nil
+	default:
+		return 0, 0, errors.New("must be 'at-least N', 'at-most N', or 'exactly N'")
+	}
+}
+
+// GetSources parses the source selection fields of a task and returns the
+// paths of the selected files.
+func (prj *Project) GetSources(fields map[string]any) ([]string, error) {
+	sel, err := FetchSourceFields(prj, fields)
+	if err != nil {
+		return nil, err
+	}
+	return prj.SelectSources(sel)
+}
+
+// SelectSources returns the sorted absolute paths of the existing files
+// matching the selection.
+func (prj *Project) SelectSources(sel *SourceSelection) ([]string, error) {
+	patterns := append([]string{}, sel.Patterns...)
+	for _, s := range sel.Exclude {
+		patterns = append(patterns, "!"+s)
+	}
+	fns, err := prj.AbsExistingPaths(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("source: %w", err)
+	}
+
+	ignores := newIgnoreMatcher(prj.fsys(), prj.BaseDir, sel.IgnoreFiles)
+
+	ret := []string{}
+	for _, fn := range fns {
+		if len(sel.Extensions) > 0 {
+			ext := strings.ToLower(path.Ext(fn))
+			found := false
+			for _, e := range sel.Extensions {
+				if ext == e {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		ignored, err := ignores.match(fn)
+		if err != nil {
+			return nil, err
+		} else if ignored {
+			if prj.Verbose {
+				prj.Printf("- ignoring: %s\n", fn)
+			}
+			continue
+		}
+		ret = append(ret, fn)
+	}
+
+	if len(ret) == 0 && sel.MinCount > 0 {
+		return nil, fmt.Errorf("no sources found")
+	} else if len(ret) < sel.MinCount {
+		return nil, fmt.Errorf("source: found %d files, at least %d required", len(ret), sel.MinCount)
+	} else if sel.MaxCount >= 0 && len(ret) > sel.MaxCount {
+		return nil, fmt.Errorf("source: found %d files, at most %d allowed", len(ret), sel.MaxCount)
+	}
+	return ret, nil
+}
+
+// ignoreRule is a single pattern from a gitignore-style file.
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func (r *ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anchored {
+		ok, _ := doublestar.Match(r.pattern, rel)
+		return ok
+	}
+	ok, _ := doublestar.Match(r.pattern, path.Base(rel))
+	return ok
+}
+
+func parseIgnoreRules(buf []byte) []*ignoreRule {
+	rules := []*ignoreRule{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		s := strings.TrimRight(scanner.Text(), " \t\r")
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		r := &ignoreRule{}
+		if s[0] == '!' {
+			r.negate = true
+			s = s[1:]
+		} else if strings.HasPrefix(s, `\!`) || strings.HasPrefix(s, `\#`) {
+			s = s[1:]
+		}
+		if strings.HasSuffix(s, "/") {
+			r.dirOnly = true
+			s = strings.TrimSuffix(s, "/")
+		}
+		if strings.Contains(s, "/") {
+			r.anchored = true
+			s = strings.TrimPrefix(s, "/")
+		}
+		if s == "" {
+			continue
+		}
+		r.pattern = s
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// ignoreMatcher applies the rules from the ignore files located in the base
+// directory and its subdirectories.
+type ignoreMatcher struct {
+	fsys  FS
+	base  string
+	names []string
+	cache map[string][]*ignoreRule
+}
+
+func newIgnoreMatcher(fsys FS, base string, names []string) *ignoreMatcher {
+	return &ignoreMatcher{
+		fsys:  fsys,
+		base:  filepath.ToSlash(base),
+		names: names,
+		cache: map[string][]*ignoreRule{},
+	}
+}
+
+func (m *ignoreMatcher) rules(dir string) ([]*ignoreRule, error) {
+	if rr, ok := m.cache[dir]; ok {
+		return rr, nil
+	}
+	rr := []*ignoreRule{}
+	for _, name := range m.names {
+		buf, err := m.fsys.ReadFile(filepath.Join(filepath.FromSlash(dir), name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		rr = append(rr, parseIgnoreRules(buf)...)
+	}
+	m.cache[dir] = rr
+	return rr, nil
+}
+
+// match reports whether the file or any of its parent directories is
+// ignored, the files outside of the base directory are never ignored.
+func (m *ignoreMatcher) match(fn string) (bool, error) {
+	if len(m.names) == 0 || !strings.HasPrefix(fn, m.base+"/") {
+		return false, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(fn, m.base+"/"), "/")
+	for i := range parts {
+		isDir := i < len(parts)-1
+		ignored := false
+		// rules from the deeper directories take precedence
+		for j := 0; j <= i; j++ {
+			dir := m.base
+			if j > 0 {
+				dir += "/" + strings.Join(parts[:j], "/")
+			}
+			rr, err := m.rules(dir)
+			if err != nil {
+				return false, err
+			}
+			rel := strings.Join(parts[j:i+1], "/")
+			for _, r := range rr {
+				if r.match(rel, isDir) {
+					ignored = !r.negate
+				}
+			}
+		}
+		if ignored {
+			return true, nil
+		}
+	}
+	return false, nil
+}
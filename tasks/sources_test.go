@@ -0,0 +1,53 @@
+package tasks
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExcludeNestedDirectory(t *testing.T) {
+	fsys := &MemFS{}
+	for _, fn := range []string{
+		"/src/icons/app.svg",
+		"/src/icons/_deprecated/old.svg",
+		"/src/icons/sub/_deprecated/older.svg",
+		"/src/_deprecated/top.svg",
+	} {
+		if err := fsys.WriteFile(fn, []byte("<svg/>"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prj := &Project{FS: fsys}
+	if err := prj.Init("/src"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		exclude string
+		want    []string
+	}{
+		{"_deprecated/", []string{"/src/icons/app.svg"}},
+		{"icons/_deprecated/", []string{
+			"/src/_deprecated/top.svg",
+			"/src/icons/app.svg",
+			"/src/icons/sub/_deprecated/older.svg",
+		}},
+		{"icons/**/_deprecated/**", []string{
+			"/src/_deprecated/top.svg",
+			"/src/icons/app.svg",
+		}},
+	}
+	for _, tt := range tests {
+		got, err := prj.SelectSources(&SourceSelection{
+			Patterns: []string{"./**/*.svg"},
+			Exclude:  []string{tt.exclude},
+			MaxCount: -1,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.exclude, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.exclude, got, tt.want)
+		}
+	}
+}
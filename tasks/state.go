@@ -0,0 +1,288 @@
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// State keeps track of the filesystem entries produced by running a project.
+// It is persisted between runs and is used by the clean command to remove
+// generated files.
+type State struct {
+	Outputs []*OutputRecord `yaml:"outputs,omitempty"`
+	Dirs    []string        `yaml:"dirs,omitempty"`
+}
+
+// OutputRecord describes a file produced by one of the tasks.
+type OutputRecord struct {
+	Path   string `yaml:"path"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// StateDir returns the directory where btr keeps its state files.
+func (prj *Project) StateDir() string {
+	return filepath.Join(prj.OutDir, ".btr")
+}
+
+func (prj *Project) stateFile() string {
+	return filepath.Join(prj.StateDir(), "state.yaml")
+}
+
+// LoadState reads the persisted state, a missing state file results in an
+// empty state.
+func (prj *Project) LoadState() (*State, error) {
+	st := &State{}
+	buf, err := prj.fsys().ReadFile(prj.stateFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(buf, st)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state from %q: %w", prj.stateFile(), err)
+	}
+	return st, nil
+}
+
+// SaveState persists the state, an empty state removes the state file.
+func (prj *Project) SaveState(st *State) error {
+	fn := prj.stateFile()
+	if st.empty() {
+		err := prj.fsys().Remove(fn)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// only succeeds when nothing else is kept there
+		prj.fsys().Remove(prj.StateDir())
+		return nil
+	}
+	sort.Slice(st.Outputs, func(i, j int) bool {
+		return st.Outputs[i].Path < st.Outputs[j].Path
+	})
+	sort.Strings(st.Dirs)
+	buf, err := yaml.Marshal(st)
+	if err != nil {
+		return err
+	}
+	err = prj.fsys().MkdirAll(prj.StateDir(), 0755)
+	if err != nil {
+		return err
+	}
+	return prj.fsys().WriteFile(fn, buf, 0666)
+}
+
+func (st *State) empty() bool {
+	return len(st.Outputs) == 0 && len(st.Dirs) == 0
+}
+
+func (st *State) addOutput(path string, data []byte) {
+	sum := sha256.Sum256(data)
+	rec := &OutputRecord{Path: path, SHA256: hex.EncodeToString(sum[:])}
+	for i, o := range st.Outputs {
+		if o.Path == path {
+			st.Outputs[i] = rec
+			return
+		}
+	}
+	st.Outputs = append(st.Outputs, rec)
+}
+
+func (st *State) addDir(path string) {
+	for _, d := range st.Dirs {
+		if d == path {
+			return
+		}
+	}
+	st.Dirs = append(st.Dirs, path)
+}
+
+// forget drops the records of a path that no longer exists.
+func (st *State) forget(path string) {
+	st.Outputs = slices.DeleteFunc(st.Outputs, func(o *OutputRecord) bool {
+		return o.Path == path
+	})
+	st.Dirs = slices.DeleteFunc(st.Dirs, func(d string) bool {
+		return d == path
+	})
+}
+
+// WriteFile writes a generated file and records it as a task output.
+func (prj *Project) WriteFile(fn string, data []byte) error {
+	return prj.writeFile(fn, data, 0666)
+}
+
+// writeFile is WriteFile with the permissions of the new file specified.
+func (prj *Project) writeFile(fn string, data []byte, perm fs.FileMode) error {
+	prj.Printf("- writing %s ... ", fn)
+	end_phase := prj.phase("write")
+	err := prj.fsys().WriteFile(fn, data, perm)
+	end_phase()
+	if err != nil {
+		prj.Printf("FAILED\n")
+		return fmt.Errorf("when writing %s: %w", fn, err)
+	}
+	prj.Printf("SUCCEEDED\n")
+	prj.profileWrite(len(data))
+	prj.RecordOutput(fn, data)
+	return nil
+}
+
+// RecordOutput registers a file that was produced by a task.
+func (prj *Project) RecordOutput(fn string, data []byte) {
+	fn = filepath.ToSlash(fn)
+	prj.outputs = append(prj.outputs, fn)
+	if prj.state != nil {
+		prj.state.addOutput(fn, data)
+	}
+}
+
+// MkdirAll creates a directory along with any necessary parents and records
+// all the created directories.
+func (prj *Project) MkdirAll(path string) error {
+	missing := []string{}
+	for p := filepath.Clean(path); ; {
+		if _, err := prj.fsys().Stat(p); err == nil {
+			break
+		}
+		missing = append(missing, p)
+		parent := filepath.Dir(p)
+		if parent == p {
+			break
+		}
+		p = parent
+	}
+	err := prj.fsys().MkdirAll(path, 0755)
+	if err != nil {
+		return err
+	}
+	if prj.state != nil {
+		for _, p := range missing {
+			prj.state.addDir(filepath.ToSlash(p))
+		}
+	}
+	return nil
+}
+
+// Clean removes the files and directories recorded in the project state.
+// Files that were modified after they have been generated are kept intact.
+// With dryRun, it only reports what would be removed.
+func (prj *Project) Clean(dryRun bool) error {
+	st, err := prj.LoadState()
+	if err != nil {
+		return err
+	}
+	if st.empty() {
+		prj.Printf("nothing to clean\n")
+		if dryRun {
+			return nil
+		}
+		// drops a leftover state file without records
+		return prj.SaveState(st)
+	}
+
+	action := "removing"
+	if dryRun {
+		action = "would remove"
+	}
+
+	kept := &State{}
+	removed := map[string]struct{}{}
+	for _, o := range st.Outputs {
+		fn := filepath.FromSlash(o.Path)
+		data, err := prj.fsys().ReadFile(fn)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != o.SHA256 {
+			prj.Printf("- WARNING: keeping %s: modified since it was generated\n", o.Path)
+			kept.Outputs = append(kept.Outputs, o)
+			continue
+		}
+		prj.Printf("- %s %s\n", action, o.Path)
+		removed[o.Path] = struct{}{}
+		if !dryRun {
+			err = prj.fsys().Remove(fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// the state dir itself goes away once nothing is kept
+	state_dir := filepath.ToSlash(prj.StateDir())
+	removed[state_dir] = struct{}{}
+
+	// remove nested directories first, the ones that contain the state dir
+	// are only removed after the state is saved
+	dirs := append([]string{}, st.Dirs...)
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") > strings.Count(dirs[j], "/")
+	})
+	deferred := []string{}
+	for _, d := range dirs {
+		path := filepath.FromSlash(d)
+		entries, err := prj.fsys().ReadDir(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		remaining := 0
+		for _, e := range entries {
+			if _, ok := removed[d+"/"+e.Name()]; !ok {
+				remaining++
+			}
+		}
+		if remaining > 0 {
+			prj.Printf("- WARNING: keeping %s: directory is not empty\n", d)
+			kept.Dirs = append(kept.Dirs, d)
+			continue
+		}
+		removed[d] = struct{}{}
+		if strings.HasPrefix(state_dir, d+"/") {
+			deferred = append(deferred, d)
+			continue
+		}
+		prj.Printf("- %s %s\n", action, d)
+		if !dryRun {
+			err = prj.fsys().Remove(path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if !kept.empty() {
+		kept.Dirs = append(kept.Dirs, deferred...)
+		deferred = nil
+	}
+	if !dryRun {
+		err = prj.SaveState(kept)
+		if err != nil {
+			return err
+		}
+	}
+	for _, d := range deferred {
+		prj.Printf("- %s %s\n", action, d)
+		if !dryRun {
+			err = prj.fsys().Remove(filepath.FromSlash(d))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
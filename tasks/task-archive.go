@@ -0,0 +1,259 @@
+package tasks
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultArchiveTime is the timestamp of the archived files unless specified
+// otherwise, it is the earliest time representable in zip files.
+var defaultArchiveTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ArchiveTask packs the source files into a zip, tar, or tar.gz archive.
+type ArchiveTask struct{}
+
+func (ArchiveTask) Run(prj *Project, fields map[string]any) error {
+	target_fn := ""
+	format := ""
+	base_dir := prj.BaseDir
+	prefix := ""
+	timestamp := ""
+	level := -1
+
+	var err error
+	for k, v := range fields {
+		if IsSourceField(k) {
+			continue
+		}
+		switch k {
+		case "target":
+			if s, ok := v.(string); ok && s != "" {
+				target_fn, err = prj.AbsTargetPath(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "format":
+			if s, ok := v.(string); ok && (s == "zip" || s == "tar" || s == "tar.gz") {
+				format = s
+			} else {
+				return fmt.Errorf("%s: must be one of 'zip', 'tar', 'tar.gz'", k)
+			}
+		case "base":
+			if s, ok := v.(string); ok && s != "" {
+				base_dir, err = prj.AbsPath(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "prefix":
+			if s, ok := v.(string); ok {
+				prefix, err = ExpandVariables(s, prj.Vars)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+				prefix = strings.Trim(path.Clean("/"+filepath.ToSlash(prefix)), "/")
+			} else {
+				return fmt.Errorf("%s: must be a string", k)
+			}
+		case "timestamp":
+			if s, ok := v.(string); ok && s != "" {
+				timestamp, err = ExpandVariables(s, prj.Vars)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "level":
+			if n, ok := v.(int); ok && n >= -1 && n <= 9 {
+				level = n
+			} else {
+				return fmt.Errorf("%s: must be an integer from 0 (no compression) to 9 (best compression)", k)
+			}
+		default:
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
+		}
+	}
+
+	if target_fn == "" {
+		return fmt.Errorf("missing field: target")
+	}
+	if format == "" {
+		lower := strings.ToLower(target_fn)
+		switch {
+		case strings.HasSuffix(lower, ".zip"):
+			format = "zip"
+		case strings.HasSuffix(lower, ".tar"):
+			format = "tar"
+		case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+			format = "tar.gz"
+		default:
+			return fmt.Errorf("target: unknown archive format, use the format field to specify it")
+		}
+	}
+
+	// the same time for all the entries, unless the file times are requested
+	var mtime time.Time
+	switch timestamp {
+	case "":
+		mtime = defaultArchiveTime
+		if os.Getenv("SOURCE_DATE_EPOCH") != "" {
+			mtime, err = buildTimestamp()
+			if err != nil {
+				return err
+			}
+		}
+	case "files":
+	default:
+		mtime, err = time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			return fmt.Errorf("timestamp: must be 'files' or a time in RFC 3339 format, e.g. 2024-01-31T12:00:00Z")
+		}
+		mtime = mtime.UTC()
+	}
+
+	source_fns, err := prj.GetSources(fields)
+	if err != nil {
+		return err
+	}
+
+	type archiveEntry struct {
+		name   string
+		source string
+		mode   int64
+		mtime  time.Time
+	}
+	entries := []*archiveEntry{}
+	for _, fn := range source_fns {
+		stat, err := prj.fsys().Stat(fn)
+		if err != nil {
+			return err
+		}
+		if stat.IsDir() || fn == target_fn {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(base_dir), filepath.FromSlash(fn))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("base: %s is not located within %s", fn, base_dir)
+		}
+		e := &archiveEntry{
+			name:   path.Join(prefix, filepath.ToSlash(rel)),
+			source: fn,
+			mode:   0644,
+			mtime:  mtime,
+		}
+		if stat.Mode().Perm()&0111 != 0 {
+			e.mode = 0755
+		}
+		if timestamp == "files" {
+			e.mtime = stat.ModTime().UTC().Truncate(time.Second)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no files to archive")
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	buf := bytes.Buffer{}
+	var zw *zip.Writer
+	var tw *tar.Writer
+	var gz *gzip.Writer
+	switch format {
+	case "zip":
+		zw = zip.NewWriter(&buf)
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	case "tar":
+		tw = tar.NewWriter(&buf)
+	case "tar.gz":
+		gz, err = gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return err
+		}
+		tw = tar.NewWriter(gz)
+	}
+
+	total_bytes := 0
+	for _, e := range entries {
+		if prj.Verbose {
+			prj.Printf("- adding: %s\n", e.name)
+		}
+		data, err := prj.ReadFile(e.source)
+		if err != nil {
+			return err
+		}
+		total_bytes += len(data)
+
+		end_phase := prj.phase("encode")
+		if zw != nil {
+			h := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: e.mtime}
+			if level == 0 {
+				h.Method = zip.Store
+			}
+			h.SetMode(fs.FileMode(e.mode))
+			var w io.Writer
+			w, err = zw.CreateHeader(h)
+			if err == nil {
+				_, err = w.Write(data)
+			}
+		} else {
+			err = tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     e.name,
+				Mode:     e.mode,
+				Size:     int64(len(data)),
+				ModTime:  e.mtime,
+			})
+			if err == nil {
+				_, err = tw.Write(data)
+			}
+		}
+		end_phase()
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.name, err)
+		}
+	}
+
+	if zw != nil {
+		err = zw.Close()
+	} else {
+		err = tw.Close()
+		if err == nil && gz != nil {
+			err = gz.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = prj.WriteFile(target_fn, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	prj.Export("count", strconv.Itoa(len(entries)))
+	prj.Export("total-bytes", strconv.Itoa(total_bytes))
+	prj.Export("archive-bytes", strconv.Itoa(buf.Len()))
+	return nil
+}
@@ -3,8 +3,8 @@ package tasks
 import (
 	"bytes"
 	"fmt"
-	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 
@@ -59,13 +59,15 @@ func (BinpackFileTask) Run(prj *Project, fields map[string]any) error {
 	}
 
 	if prj.Verbose {
-		fmt.Printf("- reading: %s\n", source_fn)
+		prj.Printf("- reading: %s\n", source_fn)
 	}
-	data, err := os.ReadFile(source_fn)
+	data, err := prj.ReadFile(source_fn)
 	if err != nil {
 		return err
 	}
+	end_phase := prj.phase("encode")
 	bytestr := bytesToHexWrappedIndented(data)
+	end_phase()
 
 	dst, err := FetchCppTargetFields(prj, fields)
 	if err != nil {
@@ -117,28 +119,28 @@ func (BinpackFileTask) Run(prj *Project, fields map[string]any) error {
 	hpp.DoneNamespace()
 	cpp.DoneNamespace()
 
-	err = hpp.WriteOutFile()
+	err = hpp.WriteOutFile(prj)
 	if err != nil {
 		return err
 	}
-	return cpp.WriteOutFile()
+	err = cpp.WriteOutFile(prj)
+	if err != nil {
+		return err
+	}
+
+	prj.Export("ident", ident)
+	prj.Export("byte-count", strconv.Itoa(len(data)))
+	return nil
 }
 
 type BinpackTask struct {
 }
 
 func (BinpackTask) Run(prj *Project, fields map[string]any) error {
-	sources := []string{}
 	targets := []*Target{}
 	var err error
 	for k, v := range fields {
 		switch k {
-		case "source":
-			sources, err = prj.GetStrings(v)
-			if err != nil {
-				return fmt.Errorf("%s: %w", k, err)
-			}
-
 		case "target":
 			targets, err = prj.GetTargets(v)
 			if err != nil {
@@ -150,18 +152,13 @@ func (BinpackTask) Run(prj *Project, fields map[string]any) error {
 		}
 	}
 
-	if len(sources) == 0 {
-		return fmt.Errorf("missing field: source")
-	}
 	if len(targets) == 0 {
 		return fmt.Errorf("missing field: target")
 	}
 
-	source_fns, err := prj.AbsExistingPaths(sources)
+	source_fns, err := prj.GetSources(fields)
 	if err != nil {
-		return fmt.Errorf("source: %w", err)
-	} else if len(source_fns) == 0 {
-		return fmt.Errorf("no sources found")
+		return err
 	}
 
 	type blobInfo struct {
@@ -172,11 +169,12 @@ func (BinpackTask) Run(prj *Project, fields map[string]any) error {
 	}
 
 	blobs := []*blobInfo{}
+	total_bytes := 0
 	for _, source_fn := range source_fns {
 		if prj.Verbose {
-			fmt.Printf("- reading: %s\n", source_fn)
+			prj.Printf("- reading: %s\n", source_fn)
 		}
-		data, err := os.ReadFile(source_fn)
+		data, err := prj.ReadFile(source_fn)
 		if err != nil {
 			return err
 		}
@@ -184,11 +182,15 @@ func (BinpackTask) Run(prj *Project, fields map[string]any) error {
 		filename := filepath.Base(source_fn)
 		ident_cpp := strings.ToLower(MakeCPPIdentStr(strings.ToLower(filename)))
 
+		total_bytes += len(data)
+		end_phase := prj.phase("encode")
 		bytestr := bytesToHexWrappedIndented(data)
+		end_phase()
 		blobs = append(blobs, &blobInfo{filename: filename, ident_cpp: ident_cpp, data: data, bytestr: bytestr})
 	}
 
 	for _, target := range targets {
+		end_phase := prj.phase("encode")
 		entries := []string{}
 
 		for _, blob := range blobs {
@@ -199,6 +201,7 @@ func (BinpackTask) Run(prj *Project, fields map[string]any) error {
 			entry_vars["ident-cpp"] = blob.ident_cpp
 			entry, err := ExpandVariables(target.Entry, entry_vars)
 			if err != nil {
+				end_phase()
 				return err
 			}
 			entries = append(entries, entry)
@@ -208,6 +211,7 @@ func (BinpackTask) Run(prj *Project, fields map[string]any) error {
 		file_vars["entries"] = strings.Join(entries, "\n\n")
 		content, err := ExpandVariables(target.Content, file_vars)
 		if err != nil {
+			end_phase()
 			return err
 		}
 
@@ -215,15 +219,15 @@ func (BinpackTask) Run(prj *Project, fields map[string]any) error {
 		out := tabwriter.NewWriter(&buf, 0, 4, 1, ' ', 0)
 		fmt.Fprint(out, content)
 		out.Flush()
+		end_phase()
 
-		fmt.Printf("- writing %s ... ", target.File)
-		err = os.WriteFile(target.File, buf.Bytes(), 0666)
-		if err == nil {
-			fmt.Printf("SUCCEEDED\n")
-		} else {
-			fmt.Printf("FAILED\n")
+		err = prj.WriteFile(target.File, buf.Bytes())
+		if err != nil {
+			return err
 		}
 	}
 
+	prj.Export("count", strconv.Itoa(len(blobs)))
+	prj.Export("total-bytes", strconv.Itoa(total_bytes))
 	return nil
 }
@@ -0,0 +1,231 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"golang.org/x/exp/maps"
+)
+
+// BuildInfoTask code-generates the version and build information.
+type BuildInfoTask struct{}
+
+// buildInfoIdents lists the identifiers the build-info task defines on its
+// own, the user fields can not use them.
+var buildInfoIdents = []string{
+	"version_major", "version_minor", "version_patch", "version_prerelease",
+	"version_build", "version_string", "build_timestamp", "build_time",
+	"git_commit", "git_commit_short", "git_describe", "git_dirty",
+	"platform_os", "platform_arch",
+}
+
+func (BuildInfoTask) Run(prj *Project, fields map[string]any) error {
+	version := ""
+	with_timestamp := true
+	with_git := true
+	user_fields := map[string]string{}
+
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "hpp-target", "cpp-target", "namespace":
+			// handled by FetchCppTargetFields
+		case "version":
+			version, err = prj.GetString(v, true)
+			if err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			if version == "" {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "timestamp":
+			if b, ok := v.(bool); ok {
+				with_timestamp = b
+			} else {
+				return fmt.Errorf("%s: must be a boolean", k)
+			}
+		case "git":
+			if b, ok := v.(bool); ok {
+				with_git = b
+			} else {
+				return fmt.Errorf("%s: must be a boolean", k)
+			}
+		case "fields":
+			m, ok := v.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: must be a map", k)
+			}
+			names_by_ident := map[string]string{}
+			field_names := maps.Keys(m)
+			sort.Strings(field_names)
+			for _, name := range field_names {
+				value := m[name]
+				ident := MakeCPPIdentStr(name)
+				if slices.Contains(buildInfoIdents, ident) {
+					return fmt.Errorf("%s: %s: conflicts with the built-in '%s'", k, name, ident)
+				} else if other, exists := names_by_ident[ident]; exists {
+					return fmt.Errorf("%s: both '%s' and '%s' are defined as '%s'", k, other, name, ident)
+				}
+				names_by_ident[ident] = name
+				s, err := prj.GetString(value, true)
+				if err != nil {
+					return fmt.Errorf("%s: %s: %w", k, name, err)
+				}
+				user_fields[name] = s
+			}
+		default:
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
+		}
+	}
+
+	dst, err := FetchCppTargetFields(prj, fields)
+	if err != nil {
+		return err
+	}
+
+	var ver *semver.Version
+	if version != "" {
+		v, err := semver.ParseTolerant(version)
+		if err != nil {
+			return fmt.Errorf("version: invalid semantic version '%s'", version)
+		}
+		ver = &v
+		prj.Export("version", v.String())
+	}
+
+	var timestamp time.Time
+	if with_timestamp {
+		timestamp, err = buildTimestamp()
+		if err != nil {
+			return err
+		}
+		prj.Export("timestamp", timestamp.Format(time.RFC3339))
+	}
+
+	if with_git {
+		prj.provideVars("${git-commit}")
+	}
+
+	hpp, cpp := dst.MakeWriters()
+	dst.PutFileHeader(hpp, cpp)
+	fmt.Fprintf(cpp, "#include %q\n\n", cpp.RelPathTo(hpp))
+	fmt.Fprint(cpp, platformDetection)
+
+	hpp.StartNamespace()
+	cpp.StartNamespace()
+
+	if ver != nil {
+		pre := []string{}
+		for _, p := range ver.Pre {
+			pre = append(pre, p.String())
+		}
+		fmt.Fprintf(hpp, "constexpr int version_major = %d;\n", ver.Major)
+		fmt.Fprintf(hpp, "constexpr int version_minor = %d;\n", ver.Minor)
+		fmt.Fprintf(hpp, "constexpr int version_patch = %d;\n", ver.Patch)
+		fmt.Fprintf(hpp, "constexpr char const* version_prerelease = %s;\n", cppStringLiteral(strings.Join(pre, ".")))
+		fmt.Fprintf(hpp, "constexpr char const* version_build = %s;\n", cppStringLiteral(strings.Join(ver.Build, ".")))
+		fmt.Fprintf(hpp, "constexpr char const* version_string = %s;\n\n", cppStringLiteral(ver.String()))
+	}
+
+	define := func(typ, name, value string) {
+		fmt.Fprintf(hpp, "extern %s const %s;\n", typ, name)
+		fmt.Fprintf(cpp, "%s const %s = %s;\n", typ, name, value)
+	}
+
+	if with_timestamp {
+		define("char const*", "build_timestamp", cppStringLiteral(timestamp.Format(time.RFC3339)))
+		define("long long", "build_time", strconv.FormatInt(timestamp.Unix(), 10))
+	}
+	if with_git {
+		define("char const*", "git_commit", cppStringLiteral(prj.Vars["git-commit"]))
+		define("char const*", "git_commit_short", cppStringLiteral(prj.Vars["git-commit-short"]))
+		define("char const*", "git_describe", cppStringLiteral(prj.Vars["git-describe"]))
+		define("bool", "git_dirty", strconv.FormatBool(prj.Vars["git-dirty"] == "true"))
+	}
+
+	define("char const*", "platform_os", "btr_platform_os")
+	define("char const*", "platform_arch", "btr_platform_arch")
+
+	names := maps.Keys(user_fields)
+	sort.Strings(names)
+	for _, name := range names {
+		define("char const*", MakeCPPIdentStr(name), cppStringLiteral(user_fields[name]))
+	}
+	fmt.Fprintf(hpp, "\n")
+	fmt.Fprintf(cpp, "\n")
+
+	hpp.DoneNamespace()
+	cpp.DoneNamespace()
+
+	err = hpp.WriteOutFile(prj)
+	if err != nil {
+		return err
+	}
+	return cpp.WriteOutFile(prj)
+}
+
+// buildTimestamp returns the current time or, for reproducible builds, the
+// time specified with the SOURCE_DATE_EPOCH environment variable.
+func buildTimestamp() (time.Time, error) {
+	if s := os.Getenv("SOURCE_DATE_EPOCH"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("SOURCE_DATE_EPOCH: invalid value '%s'", s)
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	return time.Now().UTC().Truncate(time.Second), nil
+}
+
+// platformDetection defines the btr_platform_os and btr_platform_arch macros
+// with the predefined macros supported by GCC, Clang, and MSVC.
+const platformDetection = `#if defined(__EMSCRIPTEN__)
+#define btr_platform_os "emscripten"
+#elif defined(__ANDROID__)
+#define btr_platform_os "android"
+#elif defined(_WIN32)
+#define btr_platform_os "windows"
+#elif defined(__APPLE__)
+#include <TargetConditionals.h>
+#if TARGET_OS_IPHONE
+#define btr_platform_os "ios"
+#else
+#define btr_platform_os "macos"
+#endif
+#elif defined(__linux__)
+#define btr_platform_os "linux"
+#elif defined(__FreeBSD__)
+#define btr_platform_os "freebsd"
+#elif defined(__OpenBSD__)
+#define btr_platform_os "openbsd"
+#elif defined(__NetBSD__)
+#define btr_platform_os "netbsd"
+#else
+#define btr_platform_os "unknown"
+#endif
+
+#if defined(__x86_64__) || defined(_M_X64) || defined(_M_AMD64)
+#define btr_platform_arch "x86_64"
+#elif defined(__i386__) || defined(_M_IX86)
+#define btr_platform_arch "x86"
+#elif defined(__aarch64__) || defined(_M_ARM64)
+#define btr_platform_arch "arm64"
+#elif defined(__arm__) || defined(_M_ARM)
+#define btr_platform_arch "arm"
+#elif defined(__wasm64__)
+#define btr_platform_arch "wasm64"
+#elif defined(__wasm32__) || defined(__wasm__)
+#define btr_platform_arch "wasm32"
+#elif defined(__riscv) && __riscv_xlen == 64
+#define btr_platform_arch "riscv64"
+#else
+#define btr_platform_arch "unknown"
+#endif
+
+`
@@ -0,0 +1,186 @@
+package tasks
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// checksumAlgorithms lists the supported hash functions.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"xxh64":  func() hash.Hash { return newXXH64() },
+}
+
+var invalid_var_chars_re = regexp.MustCompile(`[^-_a-zA-Z0-9.]+`)
+
+// checksumVarName turns a path into the name of the exported variable, e.g.
+// bin.app.exe for bin/app.exe, __.x for ../x, and _.env for .env.
+func checksumVarName(fn string) string {
+	parts := []string{}
+	for _, seg := range strings.Split(fn, "/") {
+		if seg == ".." {
+			parts = append(parts, "__")
+			continue
+		}
+		seg = invalid_var_chars_re.ReplaceAllString(seg, "-")
+		for _, s := range strings.Split(seg, ".") {
+			if s == "" {
+				s = "_"
+			}
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// ChecksumTask computes the hashes of the source files and writes them into a
+// manifest.
+type ChecksumTask struct{}
+
+func (ChecksumTask) Run(prj *Project, fields map[string]any) error {
+	target_fn := ""
+	algorithm := "sha256"
+	format := "text"
+	base_dir := ""
+
+	var err error
+	for k, v := range fields {
+		if IsSourceField(k) {
+			continue
+		}
+		switch k {
+		case "target":
+			if s, ok := v.(string); ok && s != "" {
+				target_fn, err = prj.AbsTargetPath(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "algorithm":
+			if s, ok := v.(string); ok && checksumAlgorithms[s] != nil {
+				algorithm = s
+			} else {
+				return fmt.Errorf("%s: must be one of 'sha256', 'sha1', 'md5', 'crc32', 'xxh64'", k)
+			}
+		case "format":
+			if s, ok := v.(string); ok && (s == "text" || s == "json") {
+				format = s
+			} else {
+				return fmt.Errorf("%s: must be one of 'text', 'json'", k)
+			}
+		case "base":
+			if s, ok := v.(string); ok && s != "" {
+				base_dir, err = prj.AbsPath(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		default:
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
+		}
+	}
+
+	if base_dir == "" {
+		// the manifest refers to the files relative to its own location
+		if target_fn != "" {
+			base_dir = filepath.ToSlash(filepath.Dir(target_fn))
+		} else {
+			base_dir = filepath.ToSlash(prj.BaseDir)
+		}
+	}
+
+	source_fns, err := prj.GetSources(fields)
+	if err != nil {
+		return err
+	}
+
+	type fileHash struct {
+		Path string `json:"path"`
+		Size int    `json:"size"`
+		Hash string `json:"hash"`
+	}
+	hashes := []*fileHash{}
+	for _, fn := range source_fns {
+		if fn == target_fn {
+			continue
+		}
+		stat, err := prj.fsys().Stat(fn)
+		if err != nil {
+			return err
+		} else if stat.IsDir() {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(base_dir), filepath.FromSlash(fn))
+		if err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+		if prj.Verbose {
+			prj.Printf("- reading: %s\n", fn)
+		}
+		data, err := prj.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		end_phase := prj.phase("encode")
+		h := checksumAlgorithms[algorithm]()
+		h.Write(data)
+		sum := hex.EncodeToString(h.Sum(nil))
+		end_phase()
+		hashes = append(hashes, &fileHash{Path: filepath.ToSlash(rel), Size: len(data), Hash: sum})
+	}
+
+	if prj.exportID != "" {
+		paths_by_name := map[string]string{}
+		for _, fh := range hashes {
+			name := checksumVarName(fh.Path)
+			if other, exists := paths_by_name[name]; exists {
+				return fmt.Errorf("both %s and %s are exported as ${%s.hash.%s}", other, fh.Path, prj.exportID, name)
+			}
+			paths_by_name[name] = fh.Path
+			prj.Export("hash."+name, fh.Hash)
+		}
+	}
+	prj.Export("count", strconv.Itoa(len(hashes)))
+
+	if target_fn == "" {
+		return nil
+	}
+
+	buf := bytes.Buffer{}
+	switch format {
+	case "text":
+		// compatible with sha256sum and similar utilities
+		for _, fh := range hashes {
+			fmt.Fprintf(&buf, "%s  %s\n", fh.Hash, fh.Path)
+		}
+	case "json":
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(map[string]any{
+			"algorithm": algorithm,
+			"files":     hashes,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return prj.WriteFile(target_fn, buf.Bytes())
+}
@@ -0,0 +1,176 @@
+package tasks
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// ConcatTask joins the source files into a single text file.
+type ConcatTask struct{}
+
+func (ConcatTask) Run(prj *Project, fields map[string]any) error {
+	target_fn := ""
+	header := ""
+	separator := ""
+	footer := ""
+	unique := false
+	line_endings := ""
+
+	var err error
+	for k, v := range fields {
+		if IsSourceField(k) {
+			continue
+		}
+		switch k {
+		case "target":
+			if s, ok := v.(string); ok && s != "" {
+				target_fn, err = prj.AbsTargetPath(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "header":
+			if s, ok := v.(string); ok {
+				header = s
+			} else {
+				return fmt.Errorf("%s: must be a string", k)
+			}
+		case "separator":
+			if s, ok := v.(string); ok {
+				separator = s
+			} else {
+				return fmt.Errorf("%s: must be a string", k)
+			}
+		case "footer":
+			if s, ok := v.(string); ok {
+				footer = s
+			} else {
+				return fmt.Errorf("%s: must be a string", k)
+			}
+		case "unique":
+			if b, ok := v.(bool); ok {
+				unique = b
+			} else {
+				return fmt.Errorf("%s: must be a boolean", k)
+			}
+		case "line-endings":
+			if s, ok := v.(string); ok && (s == "keep" || s == "lf" || s == "crlf") {
+				line_endings = s
+			} else {
+				return fmt.Errorf("%s: must be one of 'keep', 'lf', 'crlf'", k)
+			}
+		default:
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
+		}
+	}
+
+	if target_fn == "" {
+		return fmt.Errorf("missing field: target")
+	}
+
+	source_fns, err := prj.GetSources(fields)
+	if err != nil {
+		return err
+	}
+	// file10.glsl goes after file9.glsl
+	sort.SliceStable(source_fns, func(i, j int) bool {
+		return naturalCompare(source_fns[i], source_fns[j]) < 0
+	})
+
+	expand := func(field, tmpl, fn string, index int) (string, error) {
+		if tmpl == "" {
+			return "", nil
+		}
+		vars := maps.Clone(prj.Vars)
+		vars["filename"] = path.Base(fn)
+		vars["index"] = strconv.Itoa(index)
+		s, err := ExpandVariables(tmpl, vars)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", field, err)
+		}
+		return s, nil
+	}
+
+	buf := bytes.Buffer{}
+	seen := map[string]string{}
+	count := 0
+	for _, fn := range source_fns {
+		if fn == target_fn {
+			continue
+		}
+		stat, err := prj.fsys().Stat(fn)
+		if err != nil {
+			return err
+		} else if stat.IsDir() {
+			continue
+		}
+		if prj.Verbose {
+			prj.Printf("- reading: %s\n", fn)
+		}
+		data, err := prj.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		content := string(data)
+		if line_endings == "lf" || line_endings == "crlf" {
+			content = strings.ReplaceAll(content, "\r\n", "\n")
+		}
+		if unique {
+			if other, exists := seen[content]; exists {
+				if prj.Verbose {
+					prj.Printf("- skipping %s: same content as %s\n", fn, other)
+				}
+				continue
+			}
+			seen[content] = fn
+		}
+
+		count++
+		parts := []string{}
+		if count > 1 {
+			s, err := expand("separator", separator, fn, count)
+			if err != nil {
+				return err
+			}
+			parts = append(parts, s)
+		}
+		s, err := expand("header", header, fn, count)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, s, content)
+		s, err = expand("footer", footer, fn, count)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, s)
+
+		for _, s := range parts {
+			if line_endings == "lf" || line_endings == "crlf" {
+				s = strings.ReplaceAll(s, "\r\n", "\n")
+			}
+			if line_endings == "crlf" {
+				s = strings.ReplaceAll(s, "\n", "\r\n")
+			}
+			buf.WriteString(s)
+		}
+	}
+	if count == 0 {
+		return fmt.Errorf("no files to concatenate")
+	}
+
+	err = prj.WriteFile(target_fn, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	prj.Export("count", strconv.Itoa(count))
+	return nil
+}
@@ -0,0 +1,222 @@
+package tasks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// CopyTask copies the source files into the target directory.
+type CopyTask struct{}
+
+func (CopyTask) Run(prj *Project, fields map[string]any) error {
+	target_dir := ""
+	base_dir := ""
+	rename := ""
+	overwrite := "always"
+	preserve_mode := false
+
+	var err error
+	for k, v := range fields {
+		if IsSourceField(k) {
+			continue
+		}
+		switch k {
+		case "target":
+			if s, ok := v.(string); ok && s != "" {
+				target_dir, err = prj.AbsTargetPath(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "base":
+			if s, ok := v.(string); ok && s != "" {
+				base_dir, err = prj.AbsPath(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "rename":
+			if s, ok := v.(string); ok && s != "" {
+				rename = s
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "overwrite":
+			if s, ok := v.(string); ok && (s == "always" || s == "if-newer" || s == "if-changed" || s == "never") {
+				overwrite = s
+			} else {
+				return fmt.Errorf("%s: must be one of 'always', 'if-newer', 'if-changed', 'never'", k)
+			}
+		case "preserve-mode":
+			if b, ok := v.(bool); ok {
+				preserve_mode = b
+			} else {
+				return fmt.Errorf("%s: must be a boolean", k)
+			}
+		default:
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
+		}
+	}
+
+	if target_dir == "" {
+		return fmt.Errorf("missing field: target")
+	}
+
+	source_fns, err := prj.GetSources(fields)
+	if err != nil {
+		return err
+	}
+
+	// map the sources to the targets before copying anything
+	type copyItem struct {
+		source string
+		target string
+		stat   fs.FileInfo
+	}
+	items := []*copyItem{}
+	sources_by_target := map[string]string{}
+	for _, source_fn := range source_fns {
+		stat, err := prj.fsys().Stat(source_fn)
+		if err != nil {
+			return err
+		}
+		if stat.IsDir() {
+			continue
+		}
+
+		rel := path.Base(source_fn)
+		if base_dir != "" {
+			rel, err = filepath.Rel(filepath.FromSlash(base_dir), filepath.FromSlash(source_fn))
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("base: %s is not located within %s", source_fn, base_dir)
+			}
+			rel = filepath.ToSlash(rel)
+		}
+		if rename != "" {
+			name := path.Base(rel)
+			ext := path.Ext(name)
+			vars := maps.Clone(prj.Vars)
+			vars["name"] = name
+			vars["stem"] = strings.TrimSuffix(name, ext)
+			vars["ext"] = strings.TrimPrefix(ext, ".")
+			s, err := ExpandVariables(rename, vars)
+			if err != nil {
+				return fmt.Errorf("rename: %w", err)
+			} else if s == "" {
+				return fmt.Errorf("rename: empty name for %s", source_fn)
+			}
+			rel = path.Join(path.Dir(rel), filepath.ToSlash(s))
+			if path.IsAbs(rel) || filepath.IsAbs(s) || rel == ".." || strings.HasPrefix(rel, "../") {
+				return fmt.Errorf("rename: '%s' is outside of the target directory", rel)
+			}
+		}
+
+		target_fn := filepath.ToSlash(filepath.Join(filepath.FromSlash(target_dir), filepath.FromSlash(rel)))
+		if other, exists := sources_by_target[target_fn]; exists {
+			return fmt.Errorf("both %s and %s are copied to %s", other, source_fn, target_fn)
+		}
+		sources_by_target[target_fn] = source_fn
+		items = append(items, &copyItem{source: source_fn, target: target_fn, stat: stat})
+	}
+
+	copied := 0
+	skipped := 0
+	for _, item := range items {
+		target_stat, err := prj.fsys().Stat(item.target)
+		exists := err == nil
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if exists && target_stat.IsDir() {
+			return fmt.Errorf("%s is a directory", item.target)
+		}
+
+		if exists && overwrite == "never" {
+			if prj.Verbose {
+				prj.Printf("- keeping %s\n", item.target)
+			}
+			skipped++
+			continue
+		}
+
+		if prj.Verbose {
+			prj.Printf("- reading: %s\n", item.source)
+		}
+		data, err := prj.ReadFile(item.source)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			uptodate := false
+			current := data
+			switch overwrite {
+			case "if-newer":
+				uptodate = !item.stat.ModTime().After(target_stat.ModTime())
+				if uptodate {
+					// the target may differ from the source, record what is on disk
+					current, err = prj.ReadFile(item.target)
+					if err != nil {
+						return err
+					}
+				}
+			case "if-changed":
+				current, err = prj.ReadFile(item.target)
+				if err != nil {
+					return err
+				}
+				uptodate = bytes.Equal(current, data)
+			}
+			if uptodate {
+				if prj.Verbose {
+					prj.Printf("- up to date %s\n", item.target)
+				}
+				prj.RecordOutput(item.target, current)
+				skipped++
+				continue
+			}
+		}
+
+		err = prj.MkdirAll(path.Dir(item.target))
+		if err != nil {
+			return err
+		}
+		perm := fs.FileMode(0666)
+		if preserve_mode {
+			perm = item.stat.Mode().Perm()
+		}
+		err = prj.writeFile(item.target, data, perm)
+		if err != nil {
+			return err
+		}
+		if preserve_mode {
+			// the permissions of the existing files are not changed by writing
+			if c, ok := prj.fsys().(chmodFS); ok {
+				err = c.Chmod(item.target, perm)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		copied++
+	}
+
+	if skipped > 0 {
+		prj.Printf("- %d files copied, %d skipped\n", copied, skipped)
+	}
+	prj.Export("count", strconv.Itoa(copied))
+	prj.Export("skipped", strconv.Itoa(skipped))
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
-	"os"
 	"path/filepath"
 )
 
@@ -22,7 +21,7 @@ func (DirTask) Run(prj *Project, fields map[string]any) error {
 		switch k {
 		case "path":
 			if s, ok := v.(string); ok && s != "" {
-				path, err = prj.AbsPath(s)
+				path, err = prj.AbsTargetPath(s)
 				if err != nil {
 					return fmt.Errorf("path: %w", err)
 				}
@@ -56,18 +55,18 @@ func (DirTask) Run(prj *Project, fields map[string]any) error {
 			}
 
 		default:
-			fmt.Printf("- WARNING: unknown field '%s'\n", k)
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
 		}
 	}
 
 	if path == "" {
-		path = filepath.Join(os.TempDir(), "btr")
+		path = filepath.ToSlash(prj.TempDir())
 		if prj.Verbose {
-			fmt.Printf("- temporary dir: %s\n", path)
+			prj.Printf("- temporary dir: %s\n", path)
 		}
 	} else {
 		if prj.Verbose {
-			fmt.Printf("- dir: %s\n", path)
+			prj.Printf("- dir: %s\n", path)
 		}
 	}
 
@@ -77,17 +76,18 @@ func (DirTask) Run(prj *Project, fields map[string]any) error {
 		}
 		prj.Vars[varname] = path
 	}
+	prj.Export("path", path)
 
-	stat, err := os.Stat(path)
+	stat, err := prj.fsys().Stat(path)
 	if errors.Is(err, fs.ErrNotExist) {
 		if if_missing == "error" {
 			return fmt.Errorf("directory '%s' does not exist", path)
 		} else {
 			// assume if_missing = create
 			if prj.Verbose {
-				fmt.Printf("- creating directory '%s'", path)
+				prj.Printf("- creating directory '%s'", path)
 			}
-			err := os.MkdirAll(path, 0755)
+			err := prj.MkdirAll(path)
 			if err != nil {
 				return fmt.Errorf("failed to create directory '%s': %w", path, err)
 			}
@@ -101,26 +101,22 @@ func (DirTask) Run(prj *Project, fields map[string]any) error {
 		if if_exists == "error" {
 			return fmt.Errorf("directory '%s' exists", path)
 		} else if if_exists == "clean" {
-			rel, err := filepath.Rel(filepath.Dir(prj.BaseDir), path)
-			if err != nil {
-				return fmt.Errorf("path: %w", err)
-			}
-			if rel == "" || rel[0] == '.' {
+			if !prj.isRemovablePath(path) {
 				// a bit of safety: don't delete self and don't delete external paths
 				return fmt.Errorf("external path '%s' is not allowed when if_exists=clean", path)
 			}
 
-			entries, err := os.ReadDir(path)
+			entries, err := prj.fsys().ReadDir(path)
 			if err != nil {
 				return fmt.Errorf("path: %w", err)
 			}
 			if len(entries) > 0 {
 				if prj.Verbose {
-					fmt.Printf("- removing existing content in '%s'\n", path)
+					prj.Printf("- removing existing content in '%s'\n", path)
 				}
 				for _, entry := range entries {
 					subpath := filepath.Join(path, entry.Name())
-					err = os.RemoveAll(subpath)
+					err = prj.fsys().RemoveAll(subpath)
 					if err != nil {
 						return fmt.Errorf("path: %w", err)
 					}
@@ -131,3 +127,16 @@ func (DirTask) Run(prj *Project, fields map[string]any) error {
 
 	return nil
 }
+
+// isRemovablePath reports whether the content of the path can be deleted:
+// the path must be located within the parent of the project directory or
+// within the output directory.
+func (prj *Project) isRemovablePath(path string) bool {
+	for _, base := range []string{filepath.Dir(prj.BaseDir), prj.OutDir} {
+		rel, err := filepath.Rel(filepath.FromSlash(base), filepath.FromSlash(path))
+		if err == nil && rel != "" && rel[0] != '.' {
+			return true
+		}
+	}
+	return false
+}
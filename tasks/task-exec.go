@@ -0,0 +1,332 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+// ExecTask runs an external command.
+type ExecTask struct{}
+
+func (ExecTask) Run(prj *Project, fields map[string]any) error {
+	command := []string{}
+	command_line := ""
+	args := []string{}
+	shell := false
+	dir := prj.BaseDir
+	env := map[string]string{}
+	inputs := []string{}
+	outputs := []string{}
+	timeout := time.Duration(0)
+	capture := ""
+
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "command":
+			if s, ok := v.(string); ok {
+				command_line = strings.TrimSpace(s)
+			} else if command, err = getArgs(prj, v); err != nil {
+				return fmt.Errorf("%s: must be a non-empty string or an array of strings", k)
+			}
+		case "args":
+			args, err = getArgs(prj, v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		case "shell":
+			if b, ok := v.(bool); ok {
+				shell = b
+			} else {
+				return fmt.Errorf("%s: must be a boolean", k)
+			}
+		case "dir":
+			if s, ok := v.(string); ok && s != "" {
+				dir, err = prj.AbsPath(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "env":
+			m, ok := v.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: must be a map", k)
+			}
+			for name, value := range m {
+				s, err := getArg(prj, value)
+				if err != nil {
+					return fmt.Errorf("%s: %s: %w", k, name, err)
+				}
+				env[name] = s
+			}
+		case "inputs":
+			inputs, err = prj.GetStrings(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		case "outputs":
+			ss, err := prj.GetStrings(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			for _, s := range ss {
+				fn, err := prj.AbsTargetPath(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+				outputs = append(outputs, fn)
+			}
+		case "timeout":
+			s, ok := v.(string)
+			if ok {
+				timeout, err = time.ParseDuration(s)
+			}
+			if !ok || err != nil || timeout <= 0 {
+				return fmt.Errorf("%s: must be a positive duration, e.g. 30s or 5m", k)
+			}
+		case "capture":
+			if s, ok := v.(string); ok && ident_re.MatchString(s) {
+				capture = s
+			} else {
+				return fmt.Errorf("%s: must be a valid identifier", k)
+			}
+		default:
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
+		}
+	}
+
+	if shell && command_line != "" {
+		if len(args) != 0 {
+			return fmt.Errorf("command: must be a single string when shell is enabled")
+		}
+		s, err := ExpandVariables(command_line, prj.Vars)
+		if err != nil {
+			return fmt.Errorf("command: %w", err)
+		}
+		if runtime.GOOS == "windows" {
+			command = []string{"cmd", "/C", s}
+		} else {
+			command = []string{"sh", "-c", s}
+		}
+	} else if command_line != "" {
+		// split before expanding, so that the values with spaces stay intact
+		words, err := splitArgs(command_line)
+		if err != nil {
+			return fmt.Errorf("command: %w", err)
+		}
+		for _, w := range words {
+			w, err = ExpandVariables(w, prj.Vars)
+			if err != nil {
+				return fmt.Errorf("command: %w", err)
+			}
+			command = append(command, w)
+		}
+	}
+	if shell && len(command) > 0 && command_line == "" {
+		return fmt.Errorf("command: must be a single string when shell is enabled")
+	}
+	if len(command) == 0 || command[0] == "" {
+		return fmt.Errorf("missing field: command")
+	}
+	command = append(command, args...)
+
+	if _, ok := prj.fsys().(OSFS); !ok {
+		return fmt.Errorf("exec can only be used with the OS filesystem")
+	}
+
+	if capture != "" {
+		if _, exists := prj.Vars[capture]; exists {
+			return fmt.Errorf("variable '%s' already exists", capture)
+		}
+	} else if len(inputs) > 0 && len(outputs) > 0 {
+		input_fns, err := prj.AbsExistingPaths(inputs)
+		if err != nil {
+			return fmt.Errorf("inputs: %w", err)
+		} else if len(input_fns) == 0 {
+			return fmt.Errorf("inputs: no files found")
+		}
+		uptodate, err := prj.isUpToDate(input_fns, outputs)
+		if err != nil {
+			return err
+		}
+		if uptodate {
+			prj.Printf("- up to date\n")
+			return prj.recordOutputs(outputs)
+		}
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	names := maps.Keys(env)
+	sort.Strings(names)
+	for _, name := range names {
+		cmd.Env = append(cmd.Env, name+"="+env[name])
+	}
+	stdout := bytes.Buffer{}
+	if capture != "" {
+		cmd.Stdout = &stdout
+	} else {
+		cmd.Stdout = prj.logWriter()
+	}
+	cmd.Stderr = prj.logWriter()
+	// the background processes started by the command may keep the output
+	// pipes open, don't wait for them past the command itself or the timeout
+	cmd.WaitDelay = time.Second
+	if timeout > 0 {
+		killProcessGroup(cmd)
+	}
+
+	prj.Printf("- exec: %s\n", strings.Join(command, " "))
+	if prj.Verbose && dir != prj.BaseDir {
+		prj.Printf("- dir: %s\n", dir)
+	}
+	end_phase := prj.phase("exec")
+	err = cmd.Run()
+	end_phase()
+	if errors.Is(err, exec.ErrWaitDelay) && ctx.Err() == nil {
+		// the command itself succeeded
+		err = nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s: timed out after %s", command[0], timeout)
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", command[0], err)
+	}
+
+	if capture != "" {
+		s := strings.TrimRight(stdout.String(), "\r\n")
+		prj.Vars[capture] = s
+		prj.Export("stdout", s)
+	}
+	return prj.recordOutputs(outputs)
+}
+
+// isUpToDate reports whether all the outputs exist and are newer than all
+// the inputs.
+func (prj *Project) isUpToDate(inputs, outputs []string) (bool, error) {
+	newest := time.Time{}
+	for _, fn := range inputs {
+		stat, err := prj.fsys().Stat(fn)
+		if err != nil {
+			return false, err
+		}
+		if stat.ModTime().After(newest) {
+			newest = stat.ModTime()
+		}
+	}
+	for _, fn := range outputs {
+		stat, err := prj.fsys().Stat(fn)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if stat.ModTime().Before(newest) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// recordOutputs registers the files produced by an external process.
+func (prj *Project) recordOutputs(outputs []string) error {
+	for _, fn := range outputs {
+		data, err := prj.ReadFile(fn)
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("output %s was not produced", fn)
+		} else if err != nil {
+			return err
+		}
+		prj.RecordOutput(fn, data)
+	}
+	return nil
+}
+
+// getArg converts a scalar field value into a string with the variables
+// expanded.
+func getArg(prj *Project, v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return ExpandVariables(v, prj.Vars)
+	case int, float64, bool:
+		return fmt.Sprint(v), nil
+	}
+	return "", errors.New("must be a string, a number, or a boolean")
+}
+
+// getArgs converts a scalar or an array of scalars into strings with the
+// variables expanded.
+func getArgs(prj *Project, v any) ([]string, error) {
+	items, ok := v.([]any)
+	if !ok {
+		items = []any{v}
+	}
+	ret := []string{}
+	for _, item := range items {
+		s, err := getArg(prj, item)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+	return ret, nil
+}
+
+// splitArgs splits the command line into words separated with spaces, single
+// and double quotes group the words with spaces.
+func splitArgs(s string) ([]string, error) {
+	ret := []string{}
+	word := strings.Builder{}
+	inWord := false
+	quote := rune(0)
+	for _, c := range s {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				ret = append(ret, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		ret = append(ret, word.String())
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return ret, nil
+}
@@ -2,7 +2,6 @@ package tasks
 
 import (
 	"fmt"
-	"os"
 )
 
 // Convert RunFileTask to struct
@@ -16,7 +15,7 @@ func (FileTask) Run(prj *Project, fields map[string]any) error {
 		switch k {
 		case "target":
 			if s, ok := v.(string); ok && s != "" {
-				target_fn, err = prj.AbsPath(s)
+				target_fn, err = prj.AbsTargetPath(s)
 				if err != nil {
 					return fmt.Errorf("%s: %w", k, err)
 				}
@@ -25,15 +24,12 @@ func (FileTask) Run(prj *Project, fields map[string]any) error {
 			}
 		case "content":
 			if s, ok := v.(string); ok {
-				target_fn, err = prj.AbsPath(s)
-				if err != nil {
-					return fmt.Errorf("%s: %w", k, err)
-				}
+				content = s
 			} else {
 				return fmt.Errorf("%s: must be a string", k)
 			}
 		default:
-			fmt.Printf("- WARNING: unknown field '%s'\n", k)
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
 		}
 	}
 
@@ -42,12 +38,5 @@ func (FileTask) Run(prj *Project, fields map[string]any) error {
 		return err
 	}
 
-	fmt.Printf("- writing %s ... ", target_fn)
-	err = os.WriteFile(target_fn, []byte(content), 0666)
-	if err == nil {
-		fmt.Printf("SUCCEEDED\n")
-	} else {
-		fmt.Printf("FAILED\n")
-	}
-	return nil
+	return prj.WriteFile(target_fn, []byte(content))
 }
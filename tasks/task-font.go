@@ -5,9 +5,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
-	"log"
 	"math"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
@@ -23,7 +21,6 @@ import (
 type SVGFontTask struct{}
 
 func (SVGFontTask) Run(prj *Project, fields map[string]any) error {
-	sources := []string{}
 	target_fn := ""
 	html_preview_fn := ""
 	codepoint := rune(0xf000)
@@ -33,16 +30,13 @@ func (SVGFontTask) Run(prj *Project, fields map[string]any) error {
 
 	var err error
 	for k, v := range fields {
+		if IsSourceField(k) {
+			continue
+		}
 		switch k {
-		case "source":
-			sources, err = prj.GetStrings(v)
-			if err != nil {
-				return fmt.Errorf("%s: %w", k, err)
-			}
-
 		case "target":
 			if s, ok := v.(string); ok && s != "" {
-				target_fn, err = prj.AbsPath(s)
+				target_fn, err = prj.AbsTargetPath(s)
 				if err != nil {
 					return fmt.Errorf("%s: %w", k, err)
 				}
@@ -51,7 +45,7 @@ func (SVGFontTask) Run(prj *Project, fields map[string]any) error {
 			}
 		case "html-preview":
 			if s, ok := v.(string); ok && s != "" {
-				html_preview_fn, err = prj.AbsPath(s)
+				html_preview_fn, err = prj.AbsTargetPath(s)
 				if err != nil {
 					return fmt.Errorf("%s: %w", k, err)
 				}
@@ -89,7 +83,7 @@ func (SVGFontTask) Run(prj *Project, fields map[string]any) error {
 			}
 
 		default:
-			fmt.Printf("- WARNING: unknown field '%s'\n", k)
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
 		}
 	}
 
@@ -101,23 +95,17 @@ func (SVGFontTask) Run(prj *Project, fields map[string]any) error {
 	}
 
 	if prj.Verbose {
-		fmt.Printf("- font height:  %d\n", height)
-		fmt.Printf("- font descent: %d\n", descent)
+		prj.Printf("- font height:  %d\n", height)
+		prj.Printf("- font descent: %d\n", descent)
 	}
 
 	if target_fn == "" {
 		return fmt.Errorf("missing field: target")
 	}
 
-	if len(sources) == 0 {
-		return fmt.Errorf("missing field: source")
-	}
-
-	source_fns, err := prj.AbsExistingPaths(sources)
+	source_fns, err := prj.GetSources(fields)
 	if err != nil {
-		return fmt.Errorf("source: %w", err)
-	} else if len(source_fns) == 0 {
-		return fmt.Errorf("no sources found")
+		return err
 	}
 
 	glyphs := []*Glyph{}
@@ -138,9 +126,11 @@ func (SVGFontTask) Run(prj *Project, fields map[string]any) error {
 			if n < 1 {
 				n = 1
 			}
-			fmt.Printf("- reading: %s%s-> %s\n", fn, strings.Repeat(" ", n), gname)
+			prj.Printf("- reading: %s%s-> %s\n", fn, strings.Repeat(" ", n), gname)
 		}
-		g, err := readSVGFileAsGlyph(fn)
+		end_phase := prj.phase("decode")
+		g, err := readSVGFileAsGlyph(prj, fn)
+		end_phase()
 		if err != nil {
 			return err
 		}
@@ -164,20 +154,25 @@ func (SVGFontTask) Run(prj *Project, fields map[string]any) error {
 		family = family[:len(family)-len(filepath.Ext(family))]
 	}
 	if prj.Verbose {
-		fmt.Printf("- family: %s\n", family)
+		prj.Printf("- family: %s\n", family)
+	}
+	prj.Export("family", family)
+	prj.Export("glyph-count", strconv.Itoa(len(glyphs)))
+	if len(glyphs) > 0 {
+		prj.Export("codepoint-min", fmt.Sprintf("%X", glyphs[0].CodePoint))
+		prj.Export("codepoint-max", fmt.Sprintf("%X", glyphs[len(glyphs)-1].CodePoint))
 	}
 	out := bytes.Buffer{}
+	end_phase := prj.phase("encode")
 	err = composeGlyphsIntoSVGFont(&out, glyphs, ascent, descent, family)
+	end_phase()
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("- writing %s ... ", target_fn)
-	err = os.WriteFile(target_fn, out.Bytes(), 0666)
-	if err == nil {
-		fmt.Printf("SUCCEEDED\n")
-	} else {
-		fmt.Printf("FAILED\n")
+	err = prj.WriteFile(target_fn, out.Bytes())
+	if err != nil {
+		return err
 	}
 
 	if html_preview_fn != "" {
@@ -191,13 +186,7 @@ func (SVGFontTask) Run(prj *Project, fields map[string]any) error {
 			fmt.Fprintf(&out, "  <tr><td><code>%s</code></td><td><img width='20pt' src='%s'/></td></tr>\n", ident, fn)
 		}
 		fmt.Fprintf(&out, "</table></body></html>\n")
-		fmt.Printf("- writing %s ... ", html_preview_fn)
-		err = os.WriteFile(html_preview_fn, out.Bytes(), 0666)
-		if err == nil {
-			fmt.Printf("SUCCEEDED\n")
-		} else {
-			fmt.Printf("FAILED\n")
-		}
+		err = prj.WriteFile(html_preview_fn, out.Bytes())
 	}
 
 	return err
@@ -233,7 +222,7 @@ func (GlyphNamesTask) Run(prj *Project, fields map[string]any) error {
 			}
 
 		default:
-			fmt.Printf("- WARNING: unknown field '%s'\n", k)
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
 		}
 	}
 
@@ -245,29 +234,35 @@ func (GlyphNamesTask) Run(prj *Project, fields map[string]any) error {
 	}
 
 	if prj.Verbose {
-		fmt.Printf("- reading: %s\n", source_fn)
+		prj.Printf("- reading: %s\n", source_fn)
 	}
 
-	glyphs, err := extractNamedCodepoints(source_fn)
+	end_phase := prj.phase("decode")
+	glyphs, err := extractNamedCodepoints(prj, source_fn)
+	end_phase()
 	if err != nil {
 		return err
 	}
 
+	cpmin, cpmax := codepointRange(glyphs)
+	prj.Export("glyph-count", strconv.Itoa(len(glyphs)))
+	prj.Export("codepoint-min", fmt.Sprintf("%X", cpmin))
+	prj.Export("codepoint-max", fmt.Sprintf("%X", cpmax))
+
 	for _, t := range targets {
+		end_phase := prj.phase("encode")
 		buf := bytes.Buffer{}
 		out := tabwriter.NewWriter(&buf, 0, 4, 1, ' ', 0)
 		err = codegenGlyphNames(out, glyphs, maps.Clone(prj.Vars), t.Content, t.Entry)
+		out.Flush()
+		end_phase()
 		if err != nil {
 			return err
 		}
-		out.Flush()
 
-		fmt.Printf("- writing %s ... ", t.File)
-		err = os.WriteFile(t.File, buf.Bytes(), 0666)
-		if err == nil {
-			fmt.Printf("SUCCEEDED\n")
-		} else {
-			fmt.Printf("FAILED\n")
+		err = prj.WriteFile(t.File, buf.Bytes())
+		if err != nil {
+			return err
 		}
 	}
 
@@ -296,7 +291,7 @@ func (TTFTask) Run(prj *Project, fields map[string]any) error {
 
 		case "target":
 			if s, ok := v.(string); ok && s != "" {
-				target_fn, err = prj.AbsPath(s)
+				target_fn, err = prj.AbsTargetPath(s)
 				if err != nil {
 					return fmt.Errorf("%s: %w", k, err)
 				}
@@ -304,7 +299,7 @@ func (TTFTask) Run(prj *Project, fields map[string]any) error {
 				return fmt.Errorf("%s: must be a non-empty string", k)
 			}
 		default:
-			fmt.Printf("- WARNING: unknown field '%s'\n", k)
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
 		}
 	}
 
@@ -316,27 +311,38 @@ func (TTFTask) Run(prj *Project, fields map[string]any) error {
 	}
 
 	if prj.Verbose {
-		fmt.Printf("- source %q\n", source_fn)
-		fmt.Printf("- target %q\n", target_fn)
+		prj.Printf("- source %q\n", source_fn)
+		prj.Printf("- target %q\n", target_fn)
+	}
+
+	if _, ok := prj.fsys().(OSFS); !ok {
+		return fmt.Errorf("svg2ttf can only be used with the OS filesystem")
 	}
 
+	defer prj.phase("exec")()
 	cmd := exec.Command("svg2ttf", "--version")
 	_, err = cmd.CombinedOutput()
 	if err != nil {
-		log.Printf("Failed to execute svg2ttf utility\n")
-		log.Printf("Please make sure it is installed:\n")
-		log.Printf("npm install -g svg2ttf\n")
-		log.Printf("you will need to have node.js installed\n")
+		prj.Printf("Failed to execute svg2ttf utility\n")
+		prj.Printf("Please make sure it is installed:\n")
+		prj.Printf("npm install -g svg2ttf\n")
+		prj.Printf("you will need to have node.js installed\n")
 		return err
 	}
 	cmd = exec.Command("svg2ttf", source_fn, target_fn)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = prj.logWriter()
+	cmd.Stderr = prj.logWriter()
 	err = cmd.Run()
 	if err != nil {
 		return fmt.Errorf("svg2ttf: %w", err)
 	}
 
+	data, err := prj.ReadFile(target_fn)
+	if err != nil {
+		return err
+	}
+	prj.RecordOutput(target_fn, data)
+
 	return nil
 }
 
@@ -350,8 +356,8 @@ type Glyph struct {
 	Transform *svg.Transform
 }
 
-func readSVGFileAsGlyph(fn string) (*Glyph, error) {
-	data, err := os.ReadFile(fn)
+func readSVGFileAsGlyph(prj *Project, fn string) (*Glyph, error) {
+	data, err := prj.ReadFile(fn)
 	if err != nil {
 		return nil, err
 	}
@@ -657,9 +663,9 @@ type NamedCodepoint struct {
 	Unicode string `xml:"unicode,attr"`
 }
 
-func extractNamedCodepoints(source_fn string) (glyphs []*NamedCodepoint, err error) {
+func extractNamedCodepoints(prj *Project, source_fn string) (glyphs []*NamedCodepoint, err error) {
 	var buf []byte
-	buf, err = os.ReadFile(source_fn)
+	buf, err = prj.ReadFile(source_fn)
 	if err != nil {
 		return
 	}
@@ -681,10 +687,9 @@ func extractNamedCodepoints(source_fn string) (glyphs []*NamedCodepoint, err err
 	return font.Glyphs, nil
 }
 
-func codegenGlyphNames(out io.Writer, glyphs []*NamedCodepoint, globalVars map[string]string, contentTemplate, entryTemplate string) error {
+// codepointRange returns the lowest and the highest single-rune codepoints.
+func codepointRange(glyphs []*NamedCodepoint) (cpmin, cpmax rune) {
 	first := true
-	cpmin := rune(0)
-	cpmax := cpmin
 	for _, g := range glyphs {
 		runes := []rune(g.Unicode)
 		if len(runes) != 1 {
@@ -704,6 +709,11 @@ func codegenGlyphNames(out io.Writer, glyphs []*NamedCodepoint, globalVars map[s
 			}
 		}
 	}
+	return cpmin, cpmax
+}
+
+func codegenGlyphNames(out io.Writer, glyphs []*NamedCodepoint, globalVars map[string]string, contentTemplate, entryTemplate string) error {
+	cpmin, cpmax := codepointRange(glyphs)
 
 	entryLines := []string{}
 	for _, g := range glyphs {
@@ -8,9 +8,9 @@ import (
 	"image/jpeg"
 	"image/png"
 	"io"
-	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 )
@@ -73,13 +73,15 @@ func (pm *pixmapEntry) convert(dstfmt string) ([]byte, error) {
 	}
 }
 
-func loadPixmap(source_fn string, ident string) (*pixmapEntry, error) {
-	binary, err := os.ReadFile(source_fn)
+func loadPixmap(prj *Project, source_fn string, ident string) (*pixmapEntry, error) {
+	binary, err := prj.ReadFile(source_fn)
 	if err != nil {
 		return nil, err
 	}
 	reader := bytes.NewReader(binary)
+	end_phase := prj.phase("decode")
 	img, frmt, err := image.Decode(reader)
+	end_phase()
 	if err != nil {
 		return nil, err
 	}
@@ -97,14 +99,14 @@ func loadPixmap(source_fn string, ident string) (*pixmapEntry, error) {
 	return ret, nil
 }
 
-func loadPixmaps(source_fns []string) ([]*pixmapEntry, error) {
+func loadPixmaps(prj *Project, source_fns []string) ([]*pixmapEntry, error) {
 	pixmaps := []*pixmapEntry{}
 	for _, fn := range source_fns {
 		name := filepath.Base(fn)
 		name = strings.TrimSuffix(name, filepath.Ext(name))
 		name = strings.ToLower(name)
 		name = strings.ReplaceAll(name, "-", "_")
-		p, err := loadPixmap(fn, name)
+		p, err := loadPixmap(prj, fn, name)
 		if err != nil {
 			return nil, err
 		}
@@ -120,22 +122,18 @@ func loadPixmaps(source_fns []string) ([]*pixmapEntry, error) {
 type EmbedIconTask struct{}
 
 func (EmbedIconTask) Run(prj *Project, fields map[string]any) error {
-	sources := []string{}
 	target_fn := ""
 
 	var err error
 
 	for k, v := range fields {
+		if IsSourceField(k) {
+			continue
+		}
 		switch k {
-		case "source":
-			sources, err = prj.GetStrings(v)
-			if err != nil {
-				return fmt.Errorf("%s: %w", k, err)
-			}
-
 		case "target":
 			if s, ok := v.(string); ok && s != "" {
-				target_fn, err = prj.AbsPath(s)
+				target_fn, err = prj.AbsTargetPath(s)
 				if err != nil {
 					return fmt.Errorf("%s: %w", k, err)
 				}
@@ -143,44 +141,35 @@ func (EmbedIconTask) Run(prj *Project, fields map[string]any) error {
 				return fmt.Errorf("%s: must be a non-empty string", k)
 			}
 		default:
-			fmt.Printf("- WARNING: unknown field '%s'\n", k)
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
 		}
 	}
 
 	if target_fn == "" {
 		return fmt.Errorf("missing field: target")
 	}
-	if len(sources) == 0 {
-		return fmt.Errorf("missing field: source")
-	}
 
-	source_fns, err := prj.AbsExistingPaths(sources)
+	source_fns, err := prj.GetSources(fields)
 	if err != nil {
-		return fmt.Errorf("source: %w", err)
-	} else if len(source_fns) == 0 {
-		return fmt.Errorf("no sources found")
+		return err
 	}
 
-	pixmaps, err := loadPixmaps(source_fns)
+	pixmaps, err := loadPixmaps(prj, source_fns)
 	if err != nil {
 		return err
 	}
 
+	end_phase := prj.phase("encode")
 	buf := bytes.Buffer{}
 	out := tabwriter.NewWriter(&buf, 0, 4, 1, ' ', 0)
 	err = codegenGLFWIcon(out, pixmaps)
+	out.Flush()
+	end_phase()
 	if err != nil {
 		return err
 	}
-	out.Flush()
-	fmt.Printf("- writing %s ... ", target_fn)
-	err = os.WriteFile(target_fn, buf.Bytes(), 0666)
-	if err == nil {
-		fmt.Printf("SUCCEEDED\n")
-	} else {
-		fmt.Printf("FAILED\n")
-	}
-	return nil
+	prj.Export("count", strconv.Itoa(len(pixmaps)))
+	return prj.WriteFile(target_fn, buf.Bytes())
 }
 
 func codegenGLFWIcon(w io.Writer, pixmaps []*pixmapEntry) error {
@@ -268,22 +257,18 @@ func codegenGLFWIcon(w io.Writer, pixmaps []*pixmapEntry) error {
 type Win32IconTask struct{}
 
 func (Win32IconTask) Run(prj *Project, fields map[string]any) error {
-	sources := []string{}
 	target_fn := ""
 
 	var err error
 
 	for k, v := range fields {
+		if IsSourceField(k) {
+			continue
+		}
 		switch k {
-		case "source":
-			sources, err = prj.GetStrings(v)
-			if err != nil {
-				return fmt.Errorf("%s: %w", k, err)
-			}
-
 		case "target":
 			if s, ok := v.(string); ok && s != "" {
-				target_fn, err = prj.AbsPath(s)
+				target_fn, err = prj.AbsTargetPath(s)
 				if err != nil {
 					return fmt.Errorf("%s: %w", k, err)
 				}
@@ -292,42 +277,33 @@ func (Win32IconTask) Run(prj *Project, fields map[string]any) error {
 			}
 
 		default:
-			fmt.Printf("- WARNING: unknown field '%s'\n", k)
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
 		}
 	}
 
 	if target_fn == "" {
 		return fmt.Errorf("missing field: target")
 	}
-	if len(sources) == 0 {
-		return fmt.Errorf("missing field: source")
-	}
 
-	source_fns, err := prj.AbsExistingPaths(sources)
+	source_fns, err := prj.GetSources(fields)
 	if err != nil {
-		return fmt.Errorf("source: %w", err)
-	} else if len(source_fns) == 0 {
-		return fmt.Errorf("no sources found")
+		return err
 	}
 
-	pixmaps, err := loadPixmaps(source_fns)
+	pixmaps, err := loadPixmaps(prj, source_fns)
 	if err != nil {
 		return err
 	}
 
+	end_phase := prj.phase("encode")
 	buf, err := produceWin32Icon(pixmaps)
+	end_phase()
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("- writing %s ... ", target_fn)
-	err = os.WriteFile(target_fn, buf, 0666)
-	if err == nil {
-		fmt.Printf("SUCCEEDED\n")
-	} else {
-		fmt.Printf("FAILED\n")
-	}
-	return nil
+	prj.Export("count", strconv.Itoa(len(pixmaps)))
+	return prj.WriteFile(target_fn, buf)
 }
 
 func produceWin32Icon(pixmaps []*pixmapEntry) ([]byte, error) {
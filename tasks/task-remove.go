@@ -0,0 +1,143 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RemoveTask deletes the files and the empty directories matching the
+// patterns.
+type RemoveTask struct{}
+
+func (RemoveTask) Run(prj *Project, fields map[string]any) error {
+	patterns := []string{}
+	preview := false
+
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "paths":
+			patterns, err = prj.GetStrings(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		case "preview":
+			if b, ok := v.(bool); ok {
+				preview = b
+			} else {
+				return fmt.Errorf("%s: must be a boolean", k)
+			}
+		default:
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
+		}
+	}
+
+	if len(patterns) == 0 {
+		return fmt.Errorf("missing field: paths")
+	}
+
+	// the patterns are relative to the output directory, like the targets
+	for i, s := range patterns {
+		exclude := strings.HasPrefix(s, "!")
+		s, err = ExpandVariables(strings.TrimPrefix(s, "!"), prj.Vars)
+		if err != nil {
+			return fmt.Errorf("paths: %w", err)
+		}
+		if s == "" {
+			return fmt.Errorf("paths: empty pattern")
+		}
+		if !filepath.IsAbs(s) && (!exclude || strings.Contains(strings.TrimSuffix(filepath.ToSlash(s), "/"), "/")) {
+			is_dir := strings.HasSuffix(filepath.ToSlash(s), "/")
+			s = filepath.ToSlash(filepath.Join(filepath.FromSlash(prj.OutDir), s))
+			if is_dir {
+				s += "/"
+			}
+		}
+		if exclude {
+			s = "!" + s
+		}
+		patterns[i] = s
+	}
+	fns, err := prj.AbsExistingPaths(patterns)
+	if err != nil {
+		return fmt.Errorf("paths: %w", err)
+	}
+
+	// a bit of safety: don't delete the project and don't delete external paths
+	for _, fn := range fns {
+		if !prj.isRemovablePath(fn) || isParentPath(fn, filepath.ToSlash(prj.BaseDir)) {
+			return fmt.Errorf("removing '%s' is not allowed, only the paths within %s can be removed",
+				fn, filepath.ToSlash(filepath.Dir(prj.BaseDir)))
+		}
+	}
+
+	// nested entries first, so that the directories can become empty
+	sort.SliceStable(fns, func(i, j int) bool {
+		return strings.Count(fns[i], "/") > strings.Count(fns[j], "/")
+	})
+
+	action := "removing"
+	if preview {
+		action = "would remove"
+	}
+	removed := map[string]bool{}
+	files, dirs := 0, 0
+	for _, fn := range fns {
+		stat, err := prj.fsys().Stat(fn)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if stat.IsDir() {
+			entries, err := prj.fsys().ReadDir(fn)
+			if err != nil {
+				return err
+			}
+			remaining := 0
+			for _, e := range entries {
+				if !removed[fn+"/"+e.Name()] {
+					remaining++
+				}
+			}
+			if remaining > 0 {
+				if prj.Verbose {
+					prj.Printf("- keeping %s: directory is not empty\n", fn)
+				}
+				continue
+			}
+			dirs++
+		} else {
+			files++
+		}
+		prj.Printf("- %s %s\n", action, fn)
+		removed[fn] = true
+		if !preview {
+			err = prj.fsys().Remove(fn)
+			if err != nil {
+				return err
+			}
+			if prj.state != nil {
+				prj.state.forget(fn)
+			}
+		}
+	}
+
+	if preview {
+		prj.Printf("- would remove %d files, %d directories\n", files, dirs)
+	} else {
+		prj.Printf("- removed %d files, %d directories\n", files, dirs)
+	}
+	prj.Export("count", strconv.Itoa(files+dirs))
+	return nil
+}
+
+// isParentPath reports whether path is the same as or contains fn.
+func isParentPath(path, fn string) bool {
+	return fn == path || strings.HasPrefix(fn, strings.TrimSuffix(path, "/")+"/")
+}
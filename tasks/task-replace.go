@@ -0,0 +1,254 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"golang.org/x/exp/maps"
+)
+
+// ReplaceTask applies regex substitutions to the source files in place.
+type ReplaceTask struct{}
+
+// replace_ref_re matches the references in the replacements: the variables and
+// the numbered capture groups, e.g. ${1}.
+var replace_ref_re = regexp.MustCompile(`\$\{[0-9]+\}|` + dollar_curly_re.String())
+
+type replaceRule struct {
+	Pattern    *regexp.Regexp
+	Replace    string
+	MinMatches int
+}
+
+func (prj *Project) getReplaceRule(m map[string]any) (*replaceRule, error) {
+	r := &replaceRule{}
+	has_replace := false
+	var err error
+	for k, v := range m {
+		switch k {
+		case "pattern":
+			if s, ok := v.(string); ok && s != "" {
+				r.Pattern, err = regexp.Compile(s)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", k, err)
+				}
+			} else {
+				return nil, fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "replace":
+			if s, ok := v.(string); ok {
+				r.Replace = s
+				has_replace = true
+			} else {
+				return nil, fmt.Errorf("%s: must be a string", k)
+			}
+		case "min-matches":
+			if n, ok := v.(int); ok && n >= 0 {
+				r.MinMatches = n
+			} else {
+				return nil, fmt.Errorf("%s: must be a non-negative integer", k)
+			}
+		default:
+			return nil, fmt.Errorf("unknown field '%s'", k)
+		}
+	}
+	if r.Pattern == nil {
+		return nil, fmt.Errorf("missing field: pattern")
+	}
+	if !has_replace {
+		return nil, fmt.Errorf("missing field: replace")
+	}
+
+	// catch the typos in the replacement even if nothing matches
+	_, err = expandReplacement(r.Replace, r.vars(prj.Vars, "", nil))
+	if err != nil {
+		return nil, fmt.Errorf("replace: %w", err)
+	}
+	return r, nil
+}
+
+func (prj *Project) getReplaceRules(n any) ([]*replaceRule, error) {
+	rr := []*replaceRule{}
+	if m, ok := n.(map[string]any); ok {
+		r, err := prj.getReplaceRule(m)
+		if err != nil {
+			return nil, err
+		}
+		rr = append(rr, r)
+	} else if items, ok := n.([]any); ok {
+		for i, item := range items {
+			m, ok := item.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("[%d]: must be a map", i)
+			}
+			r, err := prj.getReplaceRule(m)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			rr = append(rr, r)
+		}
+	} else {
+		return nil, errors.New("must be a map or an array of maps")
+	}
+	return rr, nil
+}
+
+// vars returns the variables available in the replacement: the capture
+// groups by index and by name on top of the project variables.
+func (r *replaceRule) vars(vars map[string]string, src string, match []int) map[string]string {
+	vars = maps.Clone(vars)
+	for i, name := range r.Pattern.SubexpNames() {
+		s := ""
+		if match != nil && match[2*i] >= 0 {
+			s = src[match[2*i]:match[2*i+1]]
+		}
+		vars[strconv.Itoa(i)] = s
+		if name != "" {
+			vars[name] = s
+		}
+	}
+	return vars
+}
+
+// expandReplacement is ExpandVariables that also expands the numbered capture
+// groups.
+func expandReplacement(s string, vars map[string]string) (string, error) {
+	var err error
+	return replace_ref_re.ReplaceAllStringFunc(s, func(m string) string {
+		name := m[2 : len(m)-1]
+		if val, ok := vars[name]; ok {
+			return val
+		}
+		err = fmt.Errorf("unknown variable %s", name)
+		return ""
+	}), err
+}
+
+// replaceGroupNames returns the names of the capture groups within the rules.
+func replaceGroupNames(rules any) []string {
+	items, ok := rules.([]any)
+	if !ok {
+		items = []any{rules}
+	}
+	names := []string{}
+	for _, item := range items {
+		m, _ := item.(map[string]any)
+		s, _ := m["pattern"].(string)
+		if re, err := regexp.Compile(s); err == nil {
+			for _, name := range re.SubexpNames() {
+				if name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// apply replaces all the matches in src and returns the number of matches.
+func (r *replaceRule) apply(prj *Project, src string) (string, int, error) {
+	matches := r.Pattern.FindAllStringSubmatchIndex(src, -1)
+	if len(matches) == 0 {
+		return src, 0, nil
+	}
+	ret := make([]byte, 0, len(src))
+	last := 0
+	for _, match := range matches {
+		s, err := expandReplacement(r.Replace, r.vars(prj.Vars, src, match))
+		if err != nil {
+			return "", 0, err
+		}
+		ret = append(ret, src[last:match[0]]...)
+		ret = append(ret, s...)
+		last = match[1]
+	}
+	ret = append(ret, src[last:]...)
+	return string(ret), len(matches), nil
+}
+
+func (ReplaceTask) Run(prj *Project, fields map[string]any) error {
+	var rules []*replaceRule
+
+	var err error
+	for k, v := range fields {
+		if IsSourceField(k) {
+			continue
+		}
+		switch k {
+		case "rules":
+			rules, err = prj.getReplaceRules(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		default:
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
+		}
+	}
+
+	if len(rules) == 0 {
+		return fmt.Errorf("missing field: rules")
+	}
+
+	source_fns, err := prj.GetSources(fields)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	changed := 0
+	for _, fn := range source_fns {
+		stat, err := prj.fsys().Stat(fn)
+		if err != nil {
+			return err
+		} else if stat.IsDir() {
+			continue
+		}
+		data, err := prj.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+
+		// the rules are applied in order, each one to the result of the
+		// previous one
+		content := string(data)
+		count := 0
+		for i, r := range rules {
+			s, n, err := r.apply(prj, content)
+			if err != nil {
+				return fmt.Errorf("rules[%d]: %s: %w", i, fn, err)
+			}
+			if n < r.MinMatches {
+				return fmt.Errorf("rules[%d]: %s: %d matches of '%s', at least %d required",
+					i, fn, n, r.Pattern, r.MinMatches)
+			}
+			content = s
+			count += n
+		}
+		prj.Printf("- %s: %d replacements\n", fn, count)
+		total += count
+
+		if content == string(data) {
+			continue
+		}
+		changed++
+
+		// the patched files are sources, they are not recorded as outputs so
+		// that the clean command leaves them alone
+		prj.Printf("- writing %s ... ", fn)
+		end_phase := prj.phase("write")
+		err = prj.fsys().WriteFile(fn, []byte(content), stat.Mode().Perm())
+		end_phase()
+		if err != nil {
+			prj.Printf("FAILED\n")
+			return fmt.Errorf("when writing %s: %w", fn, err)
+		}
+		prj.Printf("SUCCEEDED\n")
+		prj.profileWrite(len(content))
+	}
+
+	prj.Export("count", strconv.Itoa(total))
+	prj.Export("files", strconv.Itoa(changed))
+	return nil
+}
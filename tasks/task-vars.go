@@ -0,0 +1,50 @@
+package tasks
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// LoadVarsTask reads variables from a data file.
+type LoadVarsTask struct{}
+
+func (LoadVarsTask) Run(prj *Project, fields map[string]any) error {
+	src := &VarsSource{}
+	for k, v := range fields {
+		switch k {
+		case "source":
+			if s, ok := v.(string); ok && s != "" {
+				src.File = s
+			} else {
+				return fmt.Errorf("%s: must be a non-empty string", k)
+			}
+		case "format":
+			if s, ok := v.(string); ok && s != "" {
+				src.Format = s
+			} else {
+				return fmt.Errorf("%s: must be one of 'json', 'yaml', 'toml', 'env'", k)
+			}
+		case "prefix":
+			if s, ok := v.(string); ok && ident_re.MatchString(s) {
+				src.Prefix = s
+			} else {
+				return fmt.Errorf("%s: must be a valid identifier", k)
+			}
+		default:
+			prj.Printf("- WARNING: unknown field '%s'\n", k)
+		}
+	}
+	if src.File == "" {
+		return fmt.Errorf("missing field: source")
+	}
+
+	n, err := prj.LoadVars(src)
+	if err != nil {
+		return err
+	}
+	if prj.Verbose {
+		prj.Printf("- loaded %d vars\n", n)
+	}
+	prj.Export("count", strconv.Itoa(n))
+	return nil
+}
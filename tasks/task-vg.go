@@ -4,39 +4,35 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/adnsv/svg"
 	"github.com/adnsv/vgr-tools/vgr"
 )
 
 type VGConvertTask struct{}
 
 func (VGConvertTask) Run(prj *Project, fields map[string]any) error {
-	sources := []string{}
-	var err error
-
-	if v, ok := fields["source"]; ok {
-		sources, err = prj.GetStrings(v)
-		if err != nil {
-			return fmt.Errorf("source field: %w", err)
-		}
-		if len(sources) == 0 {
-			return fmt.Errorf("source field: must contain one or more filenames")
-		}
-	} else {
-		return fmt.Errorf("missing field: source")
-	}
-
-	source_fns, err := prj.AbsExistingPaths(sources)
+	source_fns, err := prj.GetSources(fields)
 	if err != nil {
-		return fmt.Errorf("source: %w", err)
-	} else if len(source_fns) == 0 {
-		return fmt.Errorf("no sources found")
+		return err
 	}
 
 	inputs := []*vgr.VG{}
 	for _, fn := range source_fns {
-		vg, err := vgr.ImportSVGFile(fn)
+		data, err := prj.ReadFile(fn)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", fn, err)
+		}
+		end_phase := prj.phase("decode")
+		sg, err := svg.Parse(string(data))
+		if err != nil {
+			end_phase()
+			return fmt.Errorf("failed to read %s: %w", fn, err)
+		}
+		vg, err := vgr.ImportSVG(sg, fn)
+		end_phase()
 		if err != nil {
 			return fmt.Errorf("failed to read %s: %w", fn, err)
 		}
@@ -58,18 +54,21 @@ func (VGConvertTask) Run(prj *Project, fields map[string]any) error {
 	hpp.StartNamespace()
 	cpp.StartNamespace()
 
+	end_phase := prj.phase("encode")
 	for _, vg := range inputs {
 		writeVG(hpp, cpp, vg)
 	}
+	end_phase()
 
 	hpp.DoneNamespace()
 	cpp.DoneNamespace()
 
-	err = hpp.WriteOutFile()
+	prj.Export("count", strconv.Itoa(len(inputs)))
+	err = hpp.WriteOutFile(prj)
 	if err != nil {
 		return err
 	}
-	return cpp.WriteOutFile()
+	return cpp.WriteOutFile(prj)
 }
 
 func writeVG(hpp, cpp io.Writer, src *vgr.VG) {
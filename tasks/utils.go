@@ -3,7 +3,6 @@ package tasks
 import (
 	"bytes"
 	"fmt"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -32,7 +31,9 @@ func ReplaceExtension(filename, newExt string) string {
 	return base + newExt
 }
 
-var dollar_curly_re = regexp.MustCompile(`\$\{([_a-zA-Z][-_a-zA-Z0-9]*)\}`)
+var dollar_curly_re = regexp.MustCompile(`\$\{([_a-zA-Z][-_a-zA-Z0-9]*(\.[-_a-zA-Z0-9]+)*)\}`)
+
+var ident_re = regexp.MustCompile(`^[_a-zA-Z][-_a-zA-Z0-9]*$`)
 
 func ExpandVariables(s string, vars map[string]string) (string, error) {
 	var err error
@@ -139,6 +140,36 @@ func MakeCPPIdentStr(s string) string {
 	return ret
 }
 
+// cppStringLiteral quotes s as a C++ string literal. The bytes outside of
+// printable ASCII are written as octal escapes, which, unlike the hex ones,
+// never consume the characters that follow.
+func cppStringLiteral(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '?':
+			// avoids trigraphs
+			b.WriteString(`\?`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
 var cppReservedKeywords = [...]string{
 	"auto",
 	"break",
@@ -328,11 +359,11 @@ func FetchCppTargetFields(prj *Project, fields map[string]any) (HppCppNs, error)
 		return ret, fmt.Errorf("hpp-target must be different from cpp-target")
 	}
 
-	ret.HppTarget, err = prj.AbsPath(ret.HppTarget)
+	ret.HppTarget, err = prj.AbsTargetPath(ret.HppTarget)
 	if err != nil {
 		return ret, err
 	}
-	ret.CppTarget, err = prj.AbsPath(ret.CppTarget)
+	ret.CppTarget, err = prj.AbsTargetPath(ret.CppTarget)
 	if err != nil {
 		return ret, err
 	}
@@ -388,17 +419,9 @@ func (v *SourceFileWriter) DoneNamespace() {
 	}
 }
 
-func (v *SourceFileWriter) WriteOutFile() error {
+func (v *SourceFileWriter) WriteOutFile(prj *Project) error {
 	v.t.Flush()
-	fmt.Printf("- writing %s ... ", v.path)
-	err := os.WriteFile(v.path, v.b.Bytes(), 0666)
-	if err == nil {
-		fmt.Printf("SUCCEEDED\n")
-	} else {
-		fmt.Printf("FAILED\n")
-		return fmt.Errorf("when writing %s: %w", v.path, err)
-	}
-	return nil
+	return prj.WriteFile(v.path, v.b.Bytes())
 }
 
 func (v *SourceFileWriter) RelPathTo(other *SourceFileWriter) string {
@@ -0,0 +1,302 @@
+package tasks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"gopkg.in/yaml.v3"
+)
+
+// VarsSource describes a data file that provides variables.
+type VarsSource struct {
+	File   string `yaml:"file"`
+	Format string `yaml:"format,omitempty"` // json, yaml, toml, env; detected from the extension by default
+	Prefix string `yaml:"prefix,omitempty"` // prepended to the names as '<prefix>.'
+}
+
+// UnmarshalYAML accepts either a path or a map with the VarsSource fields.
+func (src *VarsSource) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		return n.Decode(&src.File)
+	}
+	type plain VarsSource
+	return n.Decode((*plain)(src))
+}
+
+var var_name_re = regexp.MustCompile(`^[_a-zA-Z][-_a-zA-Z0-9]*(\.[-_a-zA-Z0-9]+)*$`)
+
+// varsFormats maps the file extensions to the data formats.
+var varsFormats = map[string]string{
+	".json":       "json",
+	".yaml":       "yaml",
+	".yml":        "yaml",
+	".toml":       "toml",
+	".ini":        "toml",
+	".properties": "toml",
+	".env":        "env",
+}
+
+// LoadVars reads the variables from the data file and adds them to the
+// project vars. It fails if any of the variables is already defined.
+func (prj *Project) LoadVars(src *VarsSource) (int, error) {
+	if src.File == "" {
+		return 0, fmt.Errorf("missing file name")
+	}
+	prj.provideVars(src.File)
+	fn, err := prj.AbsPath(src.File)
+	if err != nil {
+		return 0, err
+	}
+
+	format := src.Format
+	if format == "" {
+		base := strings.ToLower(filepath.Base(fn))
+		if base == ".env" || strings.HasPrefix(base, ".env.") {
+			format = "env"
+		} else if format = varsFormats[filepath.Ext(base)]; format == "" {
+			return 0, fmt.Errorf("%s: unknown format, use the format field to specify it", fn)
+		}
+	}
+
+	if prj.Verbose {
+		prj.Printf("- reading: %s\n", fn)
+	}
+	buf, err := prj.ReadFile(fn)
+	if err != nil {
+		return 0, err
+	}
+
+	vars := map[string]string{}
+	switch format {
+	case "json":
+		var v any
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.UseNumber()
+		err = dec.Decode(&v)
+		if err == nil {
+			err = flattenVars(vars, "", v)
+		}
+	case "yaml":
+		// the nodes keep the values as written, e.g. 1.10 stays 1.10
+		var n yaml.Node
+		err = yaml.Unmarshal(buf, &n)
+		if err == nil {
+			err = flattenYAMLVars(vars, "", &n)
+		}
+	case "toml":
+		err = parseKeyValueVars(vars, buf, true)
+	case "env":
+		err = parseKeyValueVars(vars, buf, false)
+	default:
+		return 0, fmt.Errorf("format: must be one of 'json', 'yaml', 'toml', 'env'")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	names := maps.Keys(vars)
+	sort.Strings(names)
+	names_prefixed := []string{}
+	for _, k := range names {
+		name := k
+		if src.Prefix != "" {
+			name = src.Prefix + "." + k
+		}
+		if !var_name_re.MatchString(name) {
+			return 0, fmt.Errorf("%s: '%s' is not a valid variable name", fn, name)
+		}
+		if _, exists := prj.Vars[name]; exists {
+			return 0, fmt.Errorf("%s: variable '%s' is already defined, use the prefix field to avoid the conflict", fn, name)
+		}
+		names_prefixed = append(names_prefixed, name)
+	}
+	for i, k := range names {
+		prj.Vars[names_prefixed[i]] = vars[k]
+	}
+	return len(names), nil
+}
+
+// flattenVars converts nested maps and arrays into the vars with the names
+// composed from the keys and indices separated with dots, e.g. a.b.0.
+// flattenYAMLVars is flattenVars for yaml nodes, the scalars are taken
+// verbatim.
+func flattenYAMLVars(vars map[string]string, name string, n *yaml.Node) error {
+	join := func(k string) string {
+		if name == "" {
+			return k
+		}
+		return name + "." + k
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return fmt.Errorf("the content must be a map")
+		}
+		return flattenYAMLVars(vars, name, n.Content[0])
+	case yaml.AliasNode:
+		return flattenYAMLVars(vars, name, n.Alias)
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := join(n.Content[i].Value)
+			if n.Content[i].Tag == "!!merge" {
+				k = name
+			}
+			err := flattenYAMLVars(vars, k, n.Content[i+1])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			err := flattenYAMLVars(vars, join(strconv.Itoa(i)), item)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if name == "" {
+		return fmt.Errorf("the content must be a map")
+	}
+	if _, exists := vars[name]; exists {
+		return fmt.Errorf("duplicate variable '%s'", name)
+	}
+	if n.Tag == "!!null" {
+		vars[name] = ""
+	} else {
+		vars[name] = n.Value
+	}
+	return nil
+}
+
+func flattenVars(vars map[string]string, name string, v any) error {
+	join := func(k string) string {
+		if name == "" {
+			return k
+		}
+		return name + "." + k
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			err := flattenVars(vars, join(k), item)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[any]any:
+		for k, item := range v {
+			err := flattenVars(vars, join(fmt.Sprint(k)), item)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		for i, item := range v {
+			err := flattenVars(vars, join(strconv.Itoa(i)), item)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if name == "" {
+		return fmt.Errorf("the content must be a map")
+	}
+	if _, exists := vars[name]; exists {
+		return fmt.Errorf("duplicate variable '%s'", name)
+	}
+	switch v := v.(type) {
+	case nil:
+		vars[name] = ""
+	case string:
+		vars[name] = v
+	default:
+		vars[name] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// parseKeyValueVars parses the 'key = value' lines. In the toml flavor, the
+// [section] headers prefix the following keys with 'section.'; in the env
+// flavor, the 'export ' prefixes are ignored.
+func parseKeyValueVars(vars map[string]string, buf []byte, toml bool) error {
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || s[0] == '#' || (toml && s[0] == ';') {
+			continue
+		}
+		if toml && s[0] == '[' {
+			if !strings.HasSuffix(s, "]") {
+				return fmt.Errorf("line %d: invalid section header", lineno)
+			}
+			section = strings.Trim(strings.TrimSpace(s[1:len(s)-1]), `"`)
+			continue
+		}
+		if !toml {
+			s = strings.TrimPrefix(s, "export ")
+		}
+		k, v, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("line %d: missing '='", lineno)
+		}
+		k = strings.Trim(strings.TrimSpace(k), `"`)
+		if k == "" {
+			return fmt.Errorf("line %d: missing key", lineno)
+		}
+		if section != "" {
+			k = section + "." + k
+		}
+		val, err := parseValue(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineno, err)
+		}
+		if _, exists := vars[k]; exists {
+			return fmt.Errorf("line %d: duplicate variable '%s'", lineno, k)
+		}
+		vars[k] = val
+	}
+	return scanner.Err()
+}
+
+// parseValue handles double-quoted (with escapes), single-quoted (literal),
+// and bare values, the trailing comments are stripped from the bare values.
+func parseValue(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) {
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return "", fmt.Errorf("unterminated string")
+		}
+		return strconv.Unquote(s[:end+1])
+	}
+	if strings.HasPrefix(s, "'") {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
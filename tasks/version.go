@@ -0,0 +1,272 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"golang.org/x/exp/maps"
+)
+
+// VersionConstraint is the parsed content of the version field, it specifies
+// which versions of btr are able to execute the project.
+//
+// A constraint consists of space separated terms that must all be satisfied,
+// several alternatives may be separated with ||. The supported terms are:
+//
+//	0.4.0            this version or newer
+//	>=0.4.0, >0.4.0  comparisons, also <, <=, =, and !=
+//	~0.5, ~0.5.2     patch-level changes: >=0.5.0 <0.6.0, >=0.5.2 <0.6.0
+//	^1.2, ^0.5       compatible changes: >=1.2.0 <2.0.0, >=0.5.0 <0.6.0
+//
+// Partial versions are allowed, the missing components are zeros.
+type VersionConstraint struct {
+	text  string
+	check semver.Range
+	min   semver.Version
+}
+
+// ParseVersionConstraint parses the content of the version field.
+func ParseVersionConstraint(s string) (*VersionConstraint, error) {
+	c := &VersionConstraint{text: strings.TrimSpace(s)}
+	first := true
+	for _, alt := range strings.Split(s, "||") {
+		terms := strings.Fields(alt)
+		if len(terms) == 0 {
+			return nil, errors.New("empty constraint")
+		}
+		var check semver.Range
+		lower := semver.Version{}
+		for i := 0; i < len(terms); i++ {
+			t := terms[i]
+			if strings.Trim(t, "<>=!~^") == "" && i+1 < len(terms) {
+				// operator separated from the version with a space
+				i++
+				t += terms[i]
+			}
+			r, lo, err := parseVersionTerm(t)
+			if err != nil {
+				return nil, err
+			}
+			if check == nil {
+				check = r
+			} else {
+				check = check.AND(r)
+			}
+			if lo.GT(lower) {
+				lower = lo
+			}
+		}
+		if first {
+			c.check, c.min = check, lower
+			first = false
+		} else {
+			c.check = c.check.OR(check)
+			if lower.LT(c.min) {
+				c.min = lower
+			}
+		}
+	}
+	return c, nil
+}
+
+// parseVersionTerm returns the range of a single term and its lower bound.
+func parseVersionTerm(t string) (semver.Range, semver.Version, error) {
+	op := t[:len(t)-len(strings.TrimLeft(t, "<>=!~^"))]
+	s := t[len(op):]
+	v, err := semver.ParseTolerant(s)
+	if err != nil {
+		return nil, semver.Version{}, fmt.Errorf("invalid version in '%s'", t)
+	}
+	// the number of the specified components, e.g. 2 for ~0.5
+	parts := strings.Count(strings.SplitN(strings.TrimPrefix(s, "v"), "-", 2)[0], ".") + 1
+
+	switch op {
+	case "", ">=":
+		return func(x semver.Version) bool { return x.GTE(v) }, v, nil
+	case ">":
+		return func(x semver.Version) bool { return x.GT(v) }, v, nil
+	case "<":
+		return func(x semver.Version) bool { return x.LT(v) }, semver.Version{}, nil
+	case "<=":
+		return func(x semver.Version) bool { return x.LTE(v) }, semver.Version{}, nil
+	case "=", "==":
+		return func(x semver.Version) bool { return x.EQ(v) }, v, nil
+	case "!=", "!":
+		return func(x semver.Version) bool { return x.NE(v) }, semver.Version{}, nil
+	case "~":
+		upper := semver.Version{Major: v.Major, Minor: v.Minor + 1}
+		if parts == 1 {
+			upper = semver.Version{Major: v.Major + 1}
+		}
+		return versionBetween(v, upper), v, nil
+	case "^":
+		upper := semver.Version{Major: v.Major + 1}
+		if v.Major == 0 && parts > 1 {
+			upper = semver.Version{Minor: v.Minor + 1}
+			if v.Minor == 0 && parts > 2 {
+				upper = semver.Version{Patch: v.Patch + 1}
+			}
+		}
+		return versionBetween(v, upper), v, nil
+	}
+	return nil, semver.Version{}, fmt.Errorf("invalid operator in '%s'", t)
+}
+
+func versionBetween(lower, upper semver.Version) semver.Range {
+	return func(x semver.Version) bool { return x.GTE(lower) && x.LT(upper) }
+}
+
+// Check reports whether the version satisfies the constraint.
+func (c *VersionConstraint) Check(v semver.Version) bool {
+	return c.check(v)
+}
+
+// Min returns the lowest version that may satisfy the constraint.
+func (c *VersionConstraint) Min() semver.Version {
+	return c.min
+}
+
+// String returns the constraint as written in the project file, a plain
+// version is prefixed with >=.
+func (c *VersionConstraint) String() string {
+	if _, err := semver.ParseTolerant(c.text); err == nil {
+		return ">= " + c.text
+	}
+	return c.text
+}
+
+// fieldVersions lists the task fields that were introduced after 0.4.0 along
+// with the first version of btr that supports them. The fields listed under
+// "*" are common to all the task types.
+var fieldVersions = map[string]map[string]string{
+	"*": {
+		"id":           "0.5.0",
+		"exclude":      "0.5.0",
+		"extensions":   "0.5.0",
+		"ignore-files": "0.5.0",
+		"require":      "0.5.0",
+		"vars":         "0.5.0",
+		"before":       "0.5.0",
+		"after":        "0.5.0",
+	},
+}
+
+// projectFieldVersions lists the project fields that were introduced after
+// 0.4.0 along with the first version of btr that supports them.
+var projectFieldVersions = map[string]string{
+	"output-dir": "0.5.0",
+	"plugins":    "0.5.0",
+	"vars-from":  "0.5.0",
+}
+
+// typeVersions lists the task types that were introduced after 0.4.0 along
+// with the first version of btr that supports them.
+var typeVersions = map[string]string{
+	"load-vars":  "0.5.0",
+	"build-info": "0.5.0",
+	"exec":       "0.5.0",
+	"copy":       "0.5.0",
+	"remove":     "0.5.0",
+	"archive":    "0.5.0",
+	"checksum":   "0.5.0",
+	"concat":     "0.5.0",
+	"replace":    "0.5.0",
+}
+
+// declaredVersion returns the lowest version of btr the project claims to
+// support, nil if the version field is missing or invalid.
+func (prj *Project) declaredVersion() *semver.Version {
+	if prj.Version == "" {
+		return nil
+	}
+	c, err := ParseVersionConstraint(prj.Version)
+	if err != nil {
+		return nil
+	}
+	v := c.Min()
+	return &v
+}
+
+// checkTaskVersion fails if the task requires a newer btr than the running
+// one, and warns about the task types and fields that are not supported by
+// the versions of btr the project claims to support.
+func (prj *Project) checkTaskVersion(t *Task) error {
+	floor := prj.declaredVersion()
+	if t.MinVersion != "" {
+		min, err := semver.ParseTolerant(t.MinVersion)
+		if err != nil {
+			return fmt.Errorf("min-version: invalid version '%s'", t.MinVersion)
+		}
+		if prj.appVersion != nil && prj.appVersion.LT(min) {
+			return fmt.Errorf("btr version >= %s is required to execute this task, you are using version %s",
+				min, prj.appVersion)
+		}
+		if floor == nil || floor.LT(min) {
+			floor = &min
+		}
+	}
+	if floor == nil {
+		return nil
+	}
+
+	warn := func(what string, required string) {
+		prj.warnVersion(floor, "- ", what, required)
+	}
+	if v, ok := typeVersions[t.Type]; ok {
+		warn(fmt.Sprintf("type '%s'", t.Type), v)
+	}
+	keys := maps.Keys(t.Fields)
+	if t.ID != "" {
+		keys = append(keys, "id")
+	}
+	if len(t.Vars) > 0 {
+		keys = append(keys, "vars")
+	}
+	if len(t.Before) > 0 {
+		keys = append(keys, "before")
+	}
+	if len(t.After) > 0 {
+		keys = append(keys, "after")
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := fieldVersions[t.Type][k]; ok {
+			warn(fmt.Sprintf("field '%s'", k), v)
+		} else if v, ok := fieldVersions["*"][k]; ok {
+			warn(fmt.Sprintf("field '%s'", k), v)
+		}
+	}
+	return nil
+}
+
+// checkProjectVersion warns about the project fields that are not supported by
+// the versions of btr the project claims to support.
+func (prj *Project) checkProjectVersion() {
+	floor := prj.declaredVersion()
+	if floor == nil {
+		return
+	}
+	used := map[string]bool{
+		"output-dir": prj.OutputDir != "",
+		"plugins":    len(prj.Plugins) > 0,
+		"vars-from":  len(prj.VarsFrom) > 0,
+	}
+	keys := maps.Keys(projectFieldVersions)
+	sort.Strings(keys)
+	for _, k := range keys {
+		if used[k] {
+			prj.warnVersion(floor, "", fmt.Sprintf("field '%s'", k), projectFieldVersions[k])
+		}
+	}
+}
+
+func (prj *Project) warnVersion(floor *semver.Version, indent, what, required string) {
+	v, err := semver.ParseTolerant(required)
+	if err == nil && floor.LT(v) {
+		prj.Printf("%sWARNING: %s requires btr >= %s, but the project declares %s\n",
+			indent, what, v, floor)
+	}
+}
@@ -0,0 +1,411 @@
+package tasks
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileNames are the names of the project files that are picked up
+// when a directory is specified instead of a file.
+var ProjectFileNames = []string{"build-tasks.yaml", "build-tasks.yml"}
+
+// WorkspaceFileNames are the names of the files that list the projects of a
+// workspace.
+var WorkspaceFileNames = []string{"workspace.yaml", "workspace.yml"}
+
+// Workspace is a set of projects that are processed in one invocation.
+type Workspace struct {
+	Root     string
+	Projects []*WorkspaceProject
+	OutDir   string // when set, each project writes into its own subdirectory of it
+}
+
+// WorkspaceProject is a project within a workspace.
+type WorkspaceProject struct {
+	Name      string   // path relative to the workspace root, used as output prefix
+	File      string   // absolute path to the project file
+	DependsOn []string // names of the projects that must succeed first
+}
+
+// WorkspaceResult describes the outcome of processing a workspace project.
+type WorkspaceResult struct {
+	Project  *WorkspaceProject
+	Err      error
+	Skipped  bool // not processed because a dependency failed
+	Duration time.Duration
+	Outputs  int
+}
+
+// FindProjectFile returns the path to the project file within the directory,
+// or an empty string if there is none.
+func FindProjectFile(dir string) string {
+	for _, n := range ProjectFileNames {
+		fn := filepath.Join(dir, n)
+		if stat, err := os.Stat(fn); err == nil && !stat.IsDir() {
+			return fn
+		}
+	}
+	return ""
+}
+
+// DiscoverWorkspace collects the project files located in the root directory
+// and its subdirectories. Hidden directories and node_modules are skipped.
+func DiscoverWorkspace(root string) (*Workspace, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	ws := &Workspace{Root: root}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if path != root && (strings.HasPrefix(name, ".") || name == "node_modules") {
+			return filepath.SkipDir
+		}
+		if fn := FindProjectFile(path); fn != "" {
+			ws.Projects = append(ws.Projects, &WorkspaceProject{
+				Name: ws.projectName(fn),
+				File: fn,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ws.Projects) == 0 {
+		return nil, fmt.Errorf("no project files found in %s", root)
+	}
+	return ws, nil
+}
+
+// workspaceEntry is an item of the projects list in a workspace file, it is
+// either a path (or a glob pattern) or a map with the path and dependencies.
+type workspaceEntry struct {
+	Path      string   `yaml:"path"`
+	DependsOn []string `yaml:"depends-on"`
+}
+
+func (e *workspaceEntry) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		return n.Decode(&e.Path)
+	}
+	type plain workspaceEntry
+	return n.Decode((*plain)(e))
+}
+
+// LoadWorkspace reads the workspace file that lists the projects:
+//
+//	projects:
+//	  - fonts
+//	  - icons/*
+//	  - path: app/build-tasks.yaml
+//	    depends-on: [fonts]
+//
+// The paths are relative to the directory of the workspace file, they point
+// either to the project files or to the directories that contain them.
+func LoadWorkspace(fn string) (*Workspace, error) {
+	buf, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	content := struct {
+		Projects []*workspaceEntry `yaml:"projects"`
+	}{}
+	err = yaml.Unmarshal(buf, &content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workspace from %q:\n%s", fn, err)
+	}
+	root, err := filepath.Abs(filepath.Dir(fn))
+	if err != nil {
+		return nil, err
+	}
+	ws := &Workspace{Root: root}
+
+	files := map[string]*WorkspaceProject{}
+	deps := map[*WorkspaceProject][]string{}
+	for i, e := range content.Projects {
+		if e.Path == "" {
+			return nil, fmt.Errorf("projects[%d]: missing path", i)
+		}
+		fns, err := ws.resolve(e.Path)
+		if err != nil {
+			return nil, fmt.Errorf("projects[%d]: %w", i, err)
+		}
+		for _, fn := range fns {
+			p := files[fn]
+			if p == nil {
+				p = &WorkspaceProject{Name: ws.projectName(fn), File: fn}
+				files[fn] = p
+				ws.Projects = append(ws.Projects, p)
+			}
+			deps[p] = append(deps[p], e.DependsOn...)
+		}
+	}
+	if len(ws.Projects) == 0 {
+		return nil, fmt.Errorf("%s: no projects specified", fn)
+	}
+
+	for _, p := range ws.Projects {
+		for _, d := range deps[p] {
+			fns, err := ws.resolve(d)
+			if err != nil {
+				return nil, fmt.Errorf("%s: depends-on: %w", p.Name, err)
+			}
+			for _, fn := range fns {
+				dep := files[fn]
+				if dep == nil {
+					return nil, fmt.Errorf("%s: depends-on: %s is not listed in the workspace", p.Name, d)
+				} else if dep == p {
+					return nil, fmt.Errorf("%s: depends-on: a project can not depend on itself", p.Name)
+				}
+				p.DependsOn = append(p.DependsOn, dep.Name)
+			}
+		}
+	}
+	err = ws.checkCycles()
+	if err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// resolve expands a path from the workspace file into the project files.
+func (ws *Workspace) resolve(s string) ([]string, error) {
+	s = filepath.ToSlash(s)
+	if !filepath.IsAbs(s) {
+		s = filepath.ToSlash(filepath.Join(ws.Root, s))
+	}
+	matches, err := doublestar.FilepathGlob(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %q", s)
+	}
+	ret := []string{}
+	for _, m := range matches {
+		stat, err := os.Stat(m)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			ret = append(ret, m)
+		} else if fn := FindProjectFile(m); fn != "" {
+			ret = append(ret, fn)
+		} else if !strings.ContainsAny(s, "*?[{") {
+			return nil, fmt.Errorf("no project file found in %s", m)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no project files found in %s", s)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// projectName returns the path of the project relative to the workspace
+// root: the directory for the default project file names, the file
+// otherwise.
+func (ws *Workspace) projectName(fn string) string {
+	rel := fn
+	if isDefaultName(filepath.Base(fn)) {
+		rel = filepath.Dir(fn)
+	}
+	rel, err := filepath.Rel(ws.Root, rel)
+	if err != nil {
+		return filepath.ToSlash(fn)
+	}
+	if rel == "." {
+		return filepath.Base(ws.Root)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func isDefaultName(name string) bool {
+	for _, n := range ProjectFileNames {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (ws *Workspace) find(name string) *WorkspaceProject {
+	for _, p := range ws.Projects {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (ws *Workspace) checkCycles() error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := map[*WorkspaceProject]int{}
+	var visit func(p *WorkspaceProject, chain []string) error
+	visit = func(p *WorkspaceProject, chain []string) error {
+		chain = append(chain, p.Name)
+		switch marks[p] {
+		case visiting:
+			return fmt.Errorf("circular dependency: %s", strings.Join(chain, " -> "))
+		case visited:
+			return nil
+		}
+		marks[p] = visiting
+		for _, d := range p.DependsOn {
+			if err := visit(ws.find(d), chain); err != nil {
+				return err
+			}
+		}
+		marks[p] = visited
+		return nil
+	}
+	for _, p := range ws.Projects {
+		if err := visit(p, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run loads the projects and calls action for each of them. Up to jobs
+// projects are processed concurrently (jobs < 1 means no limit); a project
+// waits for its dependencies and is skipped if any of them fails. The
+// projects that share an output directory are processed one at a time. The
+// messages of each project are written to w line by line, prefixed with the
+// project name. The results are returned in the order of ws.Projects.
+func (ws *Workspace) Run(jobs int, w io.Writer, action func(prj *Project) error) []*WorkspaceResult {
+	results := make([]*WorkspaceResult, len(ws.Projects))
+	byName := map[string]*WorkspaceResult{}
+	done := map[string]chan struct{}{}
+	for i, p := range ws.Projects {
+		results[i] = &WorkspaceResult{Project: p}
+		byName[p.Name] = results[i]
+		done[p.Name] = make(chan struct{})
+	}
+	if jobs < 1 {
+		jobs = len(ws.Projects)
+	}
+	sem := make(chan struct{}, jobs)
+	outMu := &sync.Mutex{}
+	dirMu := sync.Mutex{}
+	dirLocks := map[string]*sync.Mutex{}
+
+	wg := sync.WaitGroup{}
+	for _, res := range results {
+		wg.Add(1)
+		go func(res *WorkspaceResult) {
+			defer wg.Done()
+			p := res.Project
+			defer close(done[p.Name])
+
+			for _, d := range p.DependsOn {
+				<-done[d]
+				if byName[d].Err != nil {
+					res.Skipped = true
+					res.Err = fmt.Errorf("dependency '%s' failed", d)
+					return
+				}
+			}
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			defer func() { res.Duration = time.Since(start) }()
+
+			log := &prefixWriter{mu: outMu, w: w, prefix: "[" + p.Name + "] "}
+			defer log.Flush()
+
+			prj, err := LoadProject(p.File)
+			if err != nil {
+				log.Write([]byte(err.Error() + "\n"))
+				res.Err = err
+				return
+			}
+			prj.Log = log
+			if ws.OutDir != "" {
+				// before taking the lock, which is per output directory
+				name, _ := filepath.Rel(ws.Root, prj.BaseDir)
+				err = prj.SetOutDir(filepath.Join(ws.OutDir, name))
+				if err != nil {
+					log.Write([]byte(err.Error() + "\n"))
+					res.Err = err
+					return
+				}
+			}
+
+			dirMu.Lock()
+			m := dirLocks[prj.OutDir]
+			if m == nil {
+				m = &sync.Mutex{}
+				dirLocks[prj.OutDir] = m
+			}
+			dirMu.Unlock()
+			m.Lock()
+			defer m.Unlock()
+
+			res.Err = action(prj)
+			res.Outputs = len(prj.Outputs())
+		}(res)
+	}
+	wg.Wait()
+	return results
+}
+
+// prefixWriter writes complete lines to w prefixing each of them, the
+// writes of the concurrent writers sharing the mutex do not interleave.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := strings.IndexByte(string(pw.buf), '\n')
+		if i < 0 {
+			break
+		}
+		err := pw.writeLine(pw.buf[:i+1])
+		pw.buf = pw.buf[i+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes the incomplete last line, if any.
+func (pw *prefixWriter) Flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	line := append(pw.buf, '\n')
+	pw.buf = nil
+	return pw.writeLine(line)
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	_, err := io.WriteString(pw.w, pw.prefix+string(line))
+	return err
+}
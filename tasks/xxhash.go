@@ -0,0 +1,118 @@
+package tasks
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// xxh64 implements the 64-bit xxHash algorithm (XXH64) with the zero seed, a
+// fast non-cryptographic hash.
+type xxh64 struct {
+	v     [4]uint64
+	total uint64
+	buf   [32]byte
+	n     int // bytes in buf
+}
+
+const (
+	xxhPrime1 uint64 = 11400714785074694791
+	xxhPrime2 uint64 = 14029467366897019727
+	xxhPrime3 uint64 = 1609587929392839161
+	xxhPrime4 uint64 = 9650029242287828579
+	xxhPrime5 uint64 = 2870177450012600261
+)
+
+func newXXH64() hash.Hash64 {
+	h := &xxh64{}
+	h.Reset()
+	return h
+}
+
+func (h *xxh64) Reset() {
+	var seed uint64
+	h.v = [4]uint64{seed + xxhPrime1 + xxhPrime2, seed + xxhPrime2, seed, seed - xxhPrime1}
+	h.total = 0
+	h.n = 0
+}
+
+func (h *xxh64) Size() int      { return 8 }
+func (h *xxh64) BlockSize() int { return 32 }
+
+func xxhRound(acc, input uint64) uint64 {
+	acc += input * xxhPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxhPrime1
+}
+
+func xxhMergeRound(acc, val uint64) uint64 {
+	acc ^= xxhRound(0, val)
+	return acc*xxhPrime1 + xxhPrime4
+}
+
+func (h *xxh64) Write(p []byte) (int, error) {
+	n := len(p)
+	h.total += uint64(n)
+	if h.n+len(p) < 32 {
+		h.n += copy(h.buf[h.n:], p)
+		return n, nil
+	}
+	if h.n > 0 {
+		c := copy(h.buf[h.n:], p)
+		h.stripe(h.buf[:])
+		p = p[c:]
+		h.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		h.stripe(p)
+	}
+	h.n = copy(h.buf[:], p)
+	return n, nil
+}
+
+func (h *xxh64) stripe(p []byte) {
+	for i := range h.v {
+		h.v[i] = xxhRound(h.v[i], binary.LittleEndian.Uint64(p[i*8:]))
+	}
+}
+
+func (h *xxh64) Sum64() uint64 {
+	var acc uint64
+	if h.total >= 32 {
+		v := h.v
+		acc = bits.RotateLeft64(v[0], 1) + bits.RotateLeft64(v[1], 7) +
+			bits.RotateLeft64(v[2], 12) + bits.RotateLeft64(v[3], 18)
+		for _, x := range v {
+			acc = xxhMergeRound(acc, x)
+		}
+	} else {
+		acc = xxhPrime5
+	}
+	acc += h.total
+
+	p := h.buf[:h.n]
+	for ; len(p) >= 8; p = p[8:] {
+		acc ^= xxhRound(0, binary.LittleEndian.Uint64(p))
+		acc = bits.RotateLeft64(acc, 27)*xxhPrime1 + xxhPrime4
+	}
+	if len(p) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(p)) * xxhPrime1
+		acc = bits.RotateLeft64(acc, 23)*xxhPrime2 + xxhPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		acc ^= uint64(b) * xxhPrime5
+		acc = bits.RotateLeft64(acc, 11) * xxhPrime1
+	}
+
+	acc ^= acc >> 33
+	acc *= xxhPrime2
+	acc ^= acc >> 29
+	acc *= xxhPrime3
+	acc ^= acc >> 32
+	return acc
+}
+
+func (h *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, h.Sum64())
+}